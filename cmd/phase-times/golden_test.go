@@ -0,0 +1,105 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden with the current output")
+
+// goldenTests are the runs of phase-times on testdata/small.log whose output files are
+// compared with those in testdata/golden/<name>.
+var goldenTests = []struct {
+	name string
+	args []string
+}{
+	{"default", []string{"-bins", "3"}},
+	{"raw", []string{"-raw"}},
+	{"merge-same-path", []string{"-raw", "-merge-same-path"}},
+	{"package", []string{"-groupby", "package"}},
+	{"summary", []string{"-bins", "2", "-stat", "mean", "-summary", "-stats"}},
+	{"tsv", []string{"-bins", "2", "-delimiter", `\t`}},
+}
+
+func TestGolden(t *testing.T) {
+	for _, test := range goldenTests {
+		t.Run(test.name, func(t *testing.T) {
+			out := t.TempDir()
+			args := append([]string{"-quiet", "-out", out}, test.args...)
+			args = append(args, filepath.Join("testdata", "small.log"))
+			var stdout, stderr bytes.Buffer
+			if err := run(args, nil, &stdout, &stderr); err != nil {
+				t.Fatalf("phase-times %v: %v\n%s", args, err, stderr.Bytes())
+			}
+			golden := filepath.Join("testdata", "golden", test.name)
+			if *update {
+				if err := os.RemoveAll(golden); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(golden, 0777); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, want := readDir(t, out), readDir(t, golden)
+			for name, data := range got {
+				if *update {
+					if err := os.WriteFile(filepath.Join(golden, name), data, 0666); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				if w, ok := want[name]; !ok {
+					t.Errorf("unexpected output file %s", name)
+				} else if !bytes.Equal(data, w) {
+					t.Errorf("%s differs from %s:\n%s\nwant:\n%s", name, filepath.Join(golden, name), data, w)
+				}
+			}
+			if *update {
+				return
+			}
+			for _, name := range sortedNames(want) {
+				if _, ok := got[name]; !ok {
+					t.Errorf("missing output file %s", name)
+				}
+			}
+		})
+	}
+}
+
+// readDir returns the contents of the files in dir, by name; a missing dir has none.
+func readDir(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return files
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = data
+	}
+	return files
+}
+
+func sortedNames(files map[string][]byte) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -5,15 +5,119 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bufio"
-	"encoding/csv"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dr2chase/gc-phase-times/phasetimes"
 )
 
+// options holds the command-line settings for one run.
+type options struct {
+	mergeSamePath  bool          // key compilations by package and source file, ignoring the function
+	squashPosition bool          // key compilations without the line and column of the function
+	dumpOrder      string        // if not empty, write the sorted order of compilations for each configuration here
+	floor          uint64        // phase times below this are treated as zero
+	requirePhases  int           // compilations with fewer nonzero phases than this are excluded from binning
+	unitWarn       uint64        // warn if a configuration's median compilation total (ns) is below this
+	checkMonotone  bool          // report phases whose bin ratios are not non-decreasing
+	excludeConfig  string        // regular expression for configurations to ignore
+	shareDrift     bool          // add per-phase share-of-bin-total columns and a drift footer
+	timeout        time.Duration // if nonzero, abandon the run after this long
+	bins           int           // number of bins to sort compilations into
+	maxLine        int           // longest input line that can be scanned
+	format         string        // output format, csv, json, md, html, gnuplot, benchstat, or folded
+	stat           string        // per-compilation statistic used to normalize bins
+	dup            string        // policy for repeated times for one phase of one compilation
+	phases         stringList    // if not empty, the only phases written
+	configs        stringList    // if not empty, the only configurations written
+	configRegex    string        // if not empty, only configurations matching this are written
+	sortBy         string        // if not empty, sort compilations by this phase instead of total time
+	combined       string        // if not empty, write all configurations to this one CSV file
+	raw            bool          // write per-compilation phase times instead of bins
+	absolute       bool          // write bin phase times instead of ratios
+	unit           string        // time unit for CSV output
+	hotFactor      float64       // if positive, write <config>.hotphases.txt naming phases that grow by this factor
+	top            int           // if positive, print this many of the most expensive compilations per configuration
+	groupBy        string        // if "package", write per-package totals instead of bins
+	diff           string        // if not empty, "A,B", compare configurations A and B
+	jobs           int           // number of configurations to sort and bin at once
+	stats          bool          // add per-bin variability columns
+	binMode        string        // how compilations are assigned to bins
+	binEdges       string        // if not empty, comma-separated bin edges in ns, overriding -bins
+	phaseOrder     string        // order of the phase columns, alpha, firstseen, or bytotal
+	phaseDict      string        // if not empty, write the phase column order to this file
+	minTotal       uint64        // compilations with a smaller total (ns) are left out
+	excludePhases  stringList    // phases ignored entirely
+	metric         string        // which phase measurement to report
+	culprits       bool          // write <config>.culprits.csv
+	rewrites       stringList    // pattern=>replacement rules for compilation paths
+	align          stringList    // if not empty, configurations whose shared compilations are written side by side
+	quiet          bool          // no progress lines
+	cumulative     bool          // add running-total columns
+	summary        bool          // write <config>.summary.csv
+	outDir         string        // directory for the per-configuration output files
+	stdout         bool          // write the one configuration's output to standard output
+	marker         string        // if not empty, the substring that identifies compile command lines
+	includeArch    bool          // add the compile line's GOOS and GOARCH to its configuration
+	includeZero    bool          // count zero phase times as recorded
+	renames        stringList    // old=new configuration renamings
+	mergeGenerics  bool          // key compilations without the type arguments of generic functions
+	verbose        bool          // break down the line counts by kind of line
+	state          string        // if not empty, a file of compilations from earlier runs, updated with this one's
+	groupByPhase   string        // if "category", sum the phases of each category into one column
+	categoryFile   string        // if not empty, phase categories overriding the built-in ones
+	since, until   string        // if not empty, the time window of the compile command lines kept
+	timestampRegex string        // if not empty, matches the log's timestamps, instead of the default
+	percentiles    bool          // write <config>.percentiles.csv
+	dedupeConfigs  bool          // merge configurations whose GOROOTs are the same directory
+	phaseAudit     bool          // report phases timed in some configurations but not others
+	delimiter      string        // if not empty, the CSV field delimiter
+	flushInterval  time.Duration // if nonzero, rewrite the output files this often while parsing
+	limit          int           // if positive, the most compilations kept per configuration
+	sample         int           // if positive, the size of the random sample of compilations kept per configuration
+	seed           uint64        // chooses the compilations of -sample
+	explain        string        // if not empty, pkg:func of the compilations whose binning is traced
+
+	excludeRE    *regexp.Regexp       // compiled excludeConfig
+	configRE     *regexp.Regexp       // compiled configRegex
+	statKind     phasetimes.Stat      // parsed stat
+	dupPolicy    phasetimes.DupPolicy // parsed dup
+	unitKind     phasetimes.Unit      // parsed unit
+	binModeKind  phasetimes.BinMode   // parsed binMode
+	edges        []uint64             // parsed binEdges
+	metricKind   phasetimes.Metric    // parsed metric
+	rewriteRules []phasetimes.Rewrite // parsed rewrites
+	sinceTime    time.Time            // parsed since
+	untilTime    time.Time            // parsed until
+	timestampRE  *regexp.Regexp       // compiled timestampRegex
+	comma        rune                 // parsed delimiter
+	renameMap    map[string]string    // parsed renames
+	explainPkg   string               // parsed explain
+	explainFunc  string               // parsed explain
+	bases        map[string]string    // output file name base of each configuration written; see nameFiles
+}
+
 // read standard input, scanning for one of:
 //
 // (cd ... GOPATH=/Users/drchase/work/bent/gopath ... GOROOT=/Users/drchase/work/bent/goroots/<CONFIG>/ ... -gcflags=all=-d=ssa/all/time=1 . )
@@ -31,314 +135,1384 @@ import (
 // and this any phase that tends to be non-linear in input size will be revealed as its cost relative to bin-median will grow.
 //
 func main() {
-	var scanner *bufio.Scanner
-	if len(os.Args) > 1 { // Simplify life for running under a debugger, also use arg as input file.
-		f, err := os.Open(os.Args[1])
-		check(err, "Could not open %s listed on command line", os.Args[1])
-		scanner = bufio.NewScanner(f)
-	} else {
-		scanner = bufio.NewScanner(os.Stdin)
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "phase-times: %v\n", err)
+		os.Exit(1)
 	}
-	// out := csv.NewWriter(os.Stdout)
+}
+
+// usage begins the -h output, ahead of the flag descriptions.
+const usage = `usage: phase-times [flags] [log ...]
+
+phase-times reads benchmark logs (standard input if none are named; .gz logs are
+uncompressed, and each log in a .zip, .tar, .tar.gz, or .tgz archive is read in
+turn) from builds with the compiler's -d=ssa/all/time=1 debugging flag,
+and writes, for each configuration, the compilations binned by total time with
+each bin's phase times relative to the bin's normalizing statistic.
+
+The lines it looks for are
+
+	(cd ... GOROOT=/path/to/goroots/<CONFIG>/ ... -gcflags=all=-d=ssa/all/time=1 . )
+	# <PACKAGE>
+	<PATH>:<line>:<column>:<tab><PHASE><tab>TIME(ns)<tab><TIME><tab><FUNC-OR-METHOD>
+
+where the first names the configuration (the last element of GOROOT) for the
+lines that follow, the second the package being compiled, and the third one
+phase's time for one function.  GOPATH/ and GOROOT/ prefixes of <PATH> are
+removed.  Other lines are ignored.
+
+An interrupt (^C) or SIGTERM stops the reading of logs, and the output is written
+for the compilations read so far; a second one ends phase-times at once.
 
-	cfg := "UNSET_CONFIG"
-	pkg := "UNSET_PACKAGE"
-	gopath := "UNSET_GOPATH"
-	goroot := "UNSET_GOROOT"
-	pwd := "UNSET_PWD"
+Flags:
+`
 
-	phaseIndex := newStringIndex()
+// run is the whole of the phase-times command, with the command-line arguments (not including
+// the program name) and standard files supplied by the caller.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	o := &options{unitWarn: 1000, bins: 50, maxLine: 16 << 20, format: "csv", stat: "median", dup: "first", unit: "ns", jobs: runtime.GOMAXPROCS(0), binMode: "count", phaseOrder: "firstseen", metric: "time"}
 
-	newAllPhases := func() *allPhases {
-		// This next bit ensures that for almost all cases, the right number of phases is pre-allocated
-		return &allPhases{phases: make([]phaseTime, phaseIndex.NextIndex(), phaseIndex.NextIndex())}
+	fs := flag.NewFlagSet("phase-times", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&o.mergeSamePath, "merge-same-path", o.mergeSamePath, "combine all the functions compiled from one source file into a single compilation, summing their times unless -dup is given")
+	fs.BoolVar(&o.squashPosition, "squash-position", o.squashPosition, "ignore the :line:column of a function so all its timings merge into one compilation (e.g. a file's several init functions), summing their times unless -dup is given")
+	fs.StringVar(&o.dumpOrder, "dump-order", o.dumpOrder, "write the sorted order of compilations used for binning, per configuration, to this file")
+	fs.Uint64Var(&o.floor, "floor", o.floor, "treat phase times below this many `ns` as zero (noise); this shifts medians and totals, which include only the times at or above the floor")
+	fs.IntVar(&o.requirePhases, "require-phases", o.requirePhases, "exclude compilations with fewer than `N` distinct nonzero phase times from binning, as incomplete data")
+	fs.Uint64Var(&o.unitWarn, "unit-warn", o.unitWarn, "warn when a configuration's median per-compilation total is below this many `ns`, suggesting times that are not really in ns (0 disables)")
+	fs.BoolVar(&o.checkMonotone, "check-monotone", o.checkMonotone, "report, per phase, whether its ratio is non-decreasing across bins")
+	fs.StringVar(&o.excludeConfig, "exclude-config-regex", o.excludeConfig, "ignore configurations whose name matches this regular `expression`")
+	fs.BoolVar(&o.shareDrift, "share-drift", o.shareDrift, "add columns for each phase's share of the bin total, and a footer comparing the largest bin's share to the smallest's")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "stop reading logs if the run takes longer than this, write the output for the compilations read so far, and fail; if the time runs out while writing, the configurations already written are kept")
+	fs.IntVar(&o.bins, "bins", o.bins, "sort compilations into `N` bins (at most one per compilation)")
+	fs.IntVar(&o.maxLine, "maxline", o.maxLine, "longest input line, in `bytes`, that can be read; bent's compile command lines can be very long")
+	fs.StringVar(&o.format, "format", o.format, "output `format`, one of csv, json, md (a Markdown table), html (a sortable, shaded table), gnuplot (<config>.dat and a <config>.gp script to plot it, run in the -out directory), benchstat (each compilation's phase times as benchmark results), or folded (phase times as stacks for flamegraph.pl); each configuration is written to <config>.<format>")
+	fs.StringVar(&o.stat, "stat", o.stat, "per-compilation `statistic` whose bin total normalizes the bin's phase times, one of median, mean, p90, p99, geomean (instead, the geometric mean of the bin's compilation totals), or totalmedian (the median compilation total, which unlike the phase statistics is never zero, times the bin's count)")
+	fs.StringVar(&o.dup, "dup", o.dup, "`policy` for a phase timed more than once in a compilation (e.g. recompiled generic functions), one of first, sum, last, max")
+	fs.Var(&o.phases, "phase", "write only the column for phase `NAME`; may be repeated or a comma-separated list (the normalizer still uses all phases)")
+	fs.Var(&o.configs, "config", "write only configuration `NAME`, which may begin or end with * to match a suffix or prefix; may be repeated or a comma-separated list")
+	fs.StringVar(&o.configRegex, "config-regex", o.configRegex, "write only configurations whose name matches this regular `expression`")
+	fs.StringVar(&o.sortBy, "sortby", o.sortBy, "sort compilations into bins by the time of `PHASE` instead of their total time")
+	fs.StringVar(&o.combined, "combined", o.combined, "write all configurations to this one CSV `file`, with a config column, instead of one file per configuration")
+	fs.BoolVar(&o.raw, "raw", o.raw, "skip binning and write each compilation's phase times, largest total first, to <config>.raw.csv (or the -combined file)")
+	fs.BoolVar(&o.absolute, "absolute", o.absolute, "write each bin's summed phase times instead of their ratio to the bin's normalizing statistic")
+	fs.StringVar(&o.unit, "unit", o.unit, "time `unit` for the times in CSV output, one of ns, us, ms, s; ratios are unitless and JSON is always in ns")
+	fs.Float64Var(&o.hotFactor, "hot", o.hotFactor, "write <config>.hotphases.txt naming the phases whose ratio rises monotonically across bins or grows by at least this `factor` from first bin to last (0 disables)")
+	fs.IntVar(&o.top, "top", o.top, "print the `N` most expensive compilations of each configuration, with their most expensive phase")
+	fs.StringVar(&o.groupBy, "groupby", o.groupBy, "if `package`, skip binning and write each package's summed phase times, largest total first, to <config>.package.csv")
+	fs.StringVar(&o.diff, "diff", o.diff, "print, for configurations `A,B`, each phase's B/A ratio and ns delta over the compilations both performed, and the compilations only one performed")
+	fs.IntVar(&o.jobs, "j", o.jobs, "sort and bin up to `N` configurations in parallel")
+	fs.BoolVar(&o.stats, "stats", o.stats, "add columns giving the coefficient of variation (stddev / mean), minimum, and maximum of each phase's per-compilation times in each bin")
+	fs.StringVar(&o.binMode, "binmode", o.binMode, "how compilations are assigned to bins: count (the same number in each), logtime or lintime (bins of equal width in log or linear total time)")
+	fs.StringVar(&o.binEdges, "binedges", o.binEdges, "bin compilations by total time at these comma-separated `edges` in ns (e.g. 1e6,1e7,1e8,1e9) instead of using -bins; totals past the last edge go in an overflow bin")
+	fs.StringVar(&o.phaseOrder, "phaseorder", o.phaseOrder, "`order` of the phase columns: firstseen (the order the compiler ran them in the log) alpha (sorted by name, for aligning runs of different compilers), or bytotal (most time over all configurations first)")
+	fs.StringVar(&o.phaseDict, "phasedict", o.phaseDict, "write the phase column numbers and names, in CSV column order, to this `file` (e.g. phases.txt)")
+	fs.Uint64Var(&o.minTotal, "min-total", o.minTotal, "exclude compilations whose total time is below this many `ns` before sorting and binning")
+	fs.Var(&o.excludePhases, "exclude-phase", "ignore the times of phase `NAME`, leaving it out of the columns, totals, and medians; may be repeated or a comma-separated list")
+	fs.StringVar(&o.metric, "metric", o.metric, "phase `measurement` to report, one of time, allocs, bytes; allocs and bytes need a log with memory measurements, and cannot be given a -unit")
+	fs.BoolVar(&o.culprits, "culprits", o.culprits, "also write <config>.culprits.csv, naming for each bin and phase the compilation that spent the most time in that phase")
+	fs.Var(&o.rewrites, "rewrite", "rewrite compilation paths matching a regular expression, given as `pattern=>replacement`, after the GOPATH/ and GOROOT/ normalization; may be repeated")
+	fs.Var(&o.align, "align", "write the compilations performed by every one of configurations `A,B,...` side by side, one row per compilation, to A-B-....aligned.csv")
+	fs.BoolVar(&o.quiet, "quiet", o.quiet, "do not print progress while parsing (it is only printed when standard error is a terminal), or the counts of lines, configurations, compilations, and phases found")
+	fs.BoolVar(&o.cumulative, "cumulative", o.cumulative, "add columns for the running total of the bin totals, smallest bin first, and its share of the configuration's total")
+	fs.BoolVar(&o.summary, "summary", o.summary, "also write <config>.summary.csv, giving each phase's total time and percentage of the configuration's total, largest first")
+	fs.StringVar(&o.outDir, "out", o.outDir, "write the per-configuration output files into `directory`, creating it if necessary")
+	fs.BoolVar(&o.stdout, "stdout", o.stdout, "write the output for the one configuration in the input, or selected by -config, to standard output instead of a file; reports such as -top and -diff then go to standard error")
+	fs.StringVar(&o.marker, "marker", o.marker, "recognize compile command lines, which name the configuration, by this `substring` instead of gcflags=all=-d=ssa/all/time=1 (or time=2, or either without all=)")
+	fs.BoolVar(&o.includeArch, "config-include-arch", o.includeArch, "append the GOOS and GOARCH set on each compile command line, if any, to its configuration (e.g. Base-linux-arm64), so that cross-compiled runs are not merged")
+	fs.BoolVar(&o.includeZero, "include-zero", o.includeZero, "record phase times of zero, instead of ignoring them, so that they count toward -require-phases and as the first time for -dup first")
+	fs.Var(&o.renames, "rename", "rename configuration `old=new` (after -config-include-arch), everywhere including file names; configurations renamed alike are merged; may be repeated or a comma-separated list")
+	fs.BoolVar(&o.mergeGenerics, "collapse-generics", o.mergeGenerics, "merge the instantiations of each generic function (e.g. Map[go.shape.int] and Map[go.shape.string]) into one compilation, summing their times unless -dup is given")
+	fs.BoolVar(&o.verbose, "v", o.verbose, "after parsing, also print how many lines were compile commands, package headers, phase times, excluded, blank, and ignored")
+	fs.StringVar(&o.state, "state", o.state, "add the compilations saved in this `file` (e.g. times.gob) by earlier runs to those of the logs, and save them all back to it; without logs, standard input is read unless it is a terminal")
+	fs.StringVar(&o.groupByPhase, "groupby-phase", o.groupByPhase, "if `category`, replace the phase columns with one per category of phases (ssa-build, ssa-opt, lower, regalloc, codegen, other), summing their times; -phase and -sortby then name categories")
+	fs.StringVar(&o.categoryFile, "phase-categories", o.categoryFile, "read phase categories for -groupby-phase from this `file`, one tab-separated phase and category per line, adding to or overriding the built-in ones")
+	fs.StringVar(&o.since, "since", o.since, "skip compile command lines, and their phase times, whose last preceding log timestamp is before this `time`, such as 2006-01-02T15:04:05 (UTC unless a zone is given) or 2006-01-02")
+	fs.StringVar(&o.until, "until", o.until, "skip compile command lines, and their phase times, whose last preceding log timestamp is after this `time`")
+	fs.StringVar(&o.timestampRegex, "timestamp-regex", o.timestampRegex, "recognize log timestamps for -since and -until by this regular `expression`, whose first subexpression (or whole match) is a time as for -since; the default matches one beginning a line")
+	fs.BoolVar(&o.percentiles, "percentiles", o.percentiles, "also write <config>.percentiles.csv, giving the median, 90th and 99th percentile, and maximum of each phase's per-compilation times")
+	fs.BoolVar(&o.dedupeConfigs, "dedupe-configs", o.dedupeConfigs, "merge each configuration whose GOROOT is, after following symbolic links, the same directory as an earlier one's into that one, with a warning")
+	fs.BoolVar(&o.phaseAudit, "phase-audit", o.phaseAudit, "print the phases timed in some of the configurations written but not in others, such as compiler passes renamed between versions, and the configurations lacking each")
+	fs.StringVar(&o.delimiter, "delimiter", o.delimiter, "separate CSV fields with this `character` instead of a comma; \\t or tab gives tab-separated values")
+	fs.DurationVar(&o.flushInterval, "flush-interval", o.flushInterval, "while parsing, as from a pipe during a build, rewrite the output files with the compilations parsed so far about this often (e.g. 30s); reports are printed only at the end")
+	fs.IntVar(&o.limit, "limit", o.limit, "keep only the first `N` compilations seen of each configuration, for a quick look at a huge log; this favors whatever was compiled early, such as the standard library")
+	fs.IntVar(&o.sample, "sample", o.sample, "keep a uniform random sample of `N` compilations of each configuration, bounding memory for logs of millions of compilations; the bins then approximate those of the whole log")
+	fs.Uint64Var(&o.seed, "seed", o.seed, "choose the compilations of -sample with this seed; the same seed chooses the same compilations")
+	fs.StringVar(&o.explain, "explain", o.explain, "print to standard error, for the compilations of function `pkg:func`, the phase times, median, bin, and part in each of the bin's ratios")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if o.jobs < 1 {
+		return fmt.Errorf("-j must be at least 1, not %d", o.jobs)
+	}
+	if o.sample > 0 && o.limit > 0 {
+		return fmt.Errorf("-sample and -limit cannot be used together")
+	}
+	if o.sample > 0 && o.state != "" {
+		// The saved compilations would not be sampled with the new ones.
+		return fmt.Errorf("-sample cannot be used with -state")
+	}
+	if o.stdout && o.flushInterval > 0 {
+		return fmt.Errorf("-stdout cannot be used with -flush-interval")
+	}
+	if o.stdout && (o.combined != "" || o.format == "gnuplot") {
+		return fmt.Errorf("-stdout cannot be used with -combined or -format gnuplot")
+	}
+	if o.groupByPhase != "" && o.groupByPhase != "category" {
+		return fmt.Errorf("-groupby-phase must be category, not %s", o.groupByPhase)
+	}
+	if o.categoryFile != "" && o.groupByPhase == "" {
+		return fmt.Errorf("-phase-categories needs -groupby-phase category")
+	}
+	if o.state != "" && o.excludeConfig != "" {
+		return fmt.Errorf("-state cannot be used with -exclude-config-regex, which would leave configurations out of the saved state; select them with -config instead")
+	}
+	if o.phaseOrder != "alpha" && o.phaseOrder != "firstseen" && o.phaseOrder != "bytotal" {
+		return fmt.Errorf("-phaseorder must be alpha, firstseen, or bytotal, not %s", o.phaseOrder)
+	}
+	if o.bins < 1 {
+		return fmt.Errorf("-bins must be at least 1, not %d", o.bins)
+	}
+	switch o.format {
+	case "csv", "json", "md", "html", "gnuplot", "benchstat", "folded":
+	default:
+		return fmt.Errorf("-format must be csv, json, md, html, gnuplot, benchstat, or folded, not %s", o.format)
+	}
+	if o.combined != "" && o.format != "csv" {
+		return fmt.Errorf("-combined output is only available as csv")
+	}
+	if o.raw && o.format != "csv" {
+		return fmt.Errorf("-raw output is only available as csv")
+	}
+	if o.groupBy != "" {
+		if o.groupBy != "package" {
+			return fmt.Errorf("-groupby must be package, not %s", o.groupBy)
+		}
+		if o.raw || o.combined != "" {
+			return fmt.Errorf("-groupby cannot be used with -raw or -combined")
+		}
+		if o.format != "csv" {
+			return fmt.Errorf("-groupby output is only available as csv")
+		}
+	}
+	var err error
+	if o.statKind, err = phasetimes.ParseStat(o.stat); err != nil {
+		return fmt.Errorf("bad -stat: %w", err)
+	}
+	if o.dupPolicy, err = phasetimes.ParseDupPolicy(o.dup); err != nil {
+		return fmt.Errorf("bad -dup: %w", err)
+	}
+	if o.mergeSamePath || o.squashPosition || o.mergeGenerics {
+		dupSet := false
+		fs.Visit(func(f *flag.Flag) { dupSet = dupSet || f.Name == "dup" })
+		if !dupSet {
+			o.dupPolicy = phasetimes.DupSum // the functions, positions, or instantiations merged are all real work
+		}
+	}
+	if o.unitKind, err = phasetimes.ParseUnit(o.unit); err != nil {
+		return fmt.Errorf("bad -unit: %w", err)
+	}
+	for _, r := range o.rewrites {
+		rw, err := phasetimes.ParseRewrite(r)
+		if err != nil {
+			return fmt.Errorf("bad -rewrite: %w", err)
+		}
+		o.rewriteRules = append(o.rewriteRules, rw)
+	}
+	for _, r := range o.renames {
+		i := strings.Index(r, "=")
+		if i <= 0 || i == len(r)-1 {
+			return fmt.Errorf("bad -rename: %q is not of the form old=new", r)
+		}
+		from, to := r[:i], r[i+1:]
+		if o.renameMap == nil {
+			o.renameMap = make(map[string]string)
+		}
+		if prev, ok := o.renameMap[from]; ok && prev != to {
+			return fmt.Errorf("bad -rename: %s renamed to both %s and %s", from, prev, to)
+		}
+		o.renameMap[from] = to
+	}
+	if o.metricKind, err = phasetimes.ParseMetric(o.metric); err != nil {
+		return fmt.Errorf("bad -metric: %w", err)
+	}
+	if o.metricKind != phasetimes.MetricTime {
+		if o.unitKind != phasetimes.UnitNS {
+			return fmt.Errorf("-unit %s cannot be used with -metric %s, which is a count, not a time", o.unitKind, o.metricKind)
+		}
+		o.unitWarn = 0 // counts are often small
+	}
+	if o.binModeKind, err = phasetimes.ParseBinMode(o.binMode); err != nil {
+		return fmt.Errorf("bad -binmode: %w", err)
+	}
+	if o.binModeKind != phasetimes.BinCount && o.sortBy != "" {
+		return fmt.Errorf("-binmode %s bins by total time, and cannot be used with -sortby", o.binMode)
+	}
+	if o.binEdges != "" {
+		for _, e := range strings.Split(o.binEdges, ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(e), 64)
+			if err != nil || f <= 0 {
+				return fmt.Errorf("bad -binedges: %s is not a positive number of ns", e)
+			}
+			if n := len(o.edges); n > 0 && uint64(f) <= o.edges[n-1] {
+				return fmt.Errorf("bad -binedges: edges must increase, but %s follows %d", e, o.edges[n-1])
+			}
+			o.edges = append(o.edges, uint64(f))
+		}
+		if o.sortBy != "" || o.binModeKind != phasetimes.BinCount {
+			return fmt.Errorf("-binedges bins by total time, and cannot be used with -sortby or -binmode")
+		}
+	}
+	for _, w := range []struct {
+		flag, s string
+		t       *time.Time
+	}{{"since", o.since, &o.sinceTime}, {"until", o.until, &o.untilTime}} {
+		if w.s == "" {
+			continue
+		}
+		t, ok := phasetimes.ParseTimestamp(w.s)
+		if !ok {
+			return fmt.Errorf("bad -%s: %q is not a time such as 2006-01-02T15:04:05", w.flag, w.s)
+		}
+		*w.t = t
+	}
+	if o.delimiter != "" {
+		d := o.delimiter
+		if d == `\t` || d == "tab" {
+			d = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(d)
+		if size != len(d) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+			return fmt.Errorf("bad -delimiter: %q is not a single character other than a quote or newline", o.delimiter)
+		}
+		o.comma = r
+	}
+	if o.explain != "" {
+		i := strings.Index(o.explain, ":")
+		if i < 0 {
+			return fmt.Errorf("bad -explain %q: expected pkg:func", o.explain)
+		}
+		o.explainPkg, o.explainFunc = o.explain[:i], o.explain[i+1:]
+	}
+	if o.timestampRegex != "" {
+		if o.timestampRE, err = regexp.Compile(o.timestampRegex); err != nil {
+			return fmt.Errorf("bad -timestamp-regex: %w", err)
+		}
+	}
+	if o.excludeConfig != "" {
+		o.excludeRE, err = regexp.Compile(o.excludeConfig)
+		if err != nil {
+			return fmt.Errorf("bad -exclude-config-regex: %w", err)
+		}
 	}
 
-	allCompilations := make(map[string]map[compilation]*allPhases)
-	var compilations map[compilation]*allPhases
+	if o.configRegex != "" {
+		if o.configRE, err = regexp.Compile(o.configRegex); err != nil {
+			return fmt.Errorf("bad -config-regex: %w", err)
+		}
+	}
+
+	timeoutCtx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		timeoutCtx, cancel = context.WithTimeout(timeoutCtx, o.timeout)
+		defer cancel()
+	}
+	checkTimeout := func() error {
+		if err := timeoutCtx.Err(); err != nil {
+			return fmt.Errorf("run exceeded -timeout %v: %w", o.timeout, err)
+		}
+		return nil
+	}
+	// The first interrupt cancels the parse, to write what was parsed; once it has,
+	// the signals are reset, so that a second interrupt ends the process.
+	ctx, stopSignals := signal.NotifyContext(timeoutCtx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		<-ctx.Done()
+		stopSignals()
+	}()
+
+	if o.outDir != "" {
+		if err := os.MkdirAll(o.outDir, 0777); err != nil {
+			return fmt.Errorf("could not create -out directory: %w", err)
+		}
+	}
+
+	var prog *progress
+	if isTerminal(stderr) && !o.quiet {
+		prog = &progress{w: stderr, last: time.Now()}
+	}
+
+	p := phasetimes.NewParser(phasetimes.Options{
+		MergeSamePath:  o.mergeSamePath,
+		SquashPosition: o.squashPosition,
+		Floor:          o.floor,
+		ExcludeConfig:  o.excludeRE,
+		MaxLine:        o.maxLine,
+		Dup:            o.dupPolicy,
+		ExcludePhases:  o.excludePhases,
+		Metric:         o.metricKind,
+		Rewrites:       o.rewriteRules,
+		Marker:         o.marker,
+		IncludeArch:    o.includeArch,
+		IncludeZero:    o.includeZero,
+		Renames:        o.renameMap,
+		MergeGenerics:  o.mergeGenerics,
+		Since:          o.sinceTime,
+		Until:          o.untilTime,
+		Timestamp:      o.timestampRE,
+		ResolveGOROOT:  o.dedupeConfigs,
+		Limit:          o.limit,
+		Sample:         o.sample,
+		Seed:           o.seed,
+	})
+	if prog != nil {
+		prog.result = p.Result()
+		p.Progress = prog.report
+	}
+	if o.flushInterval > 0 {
+		p.InterimEvery = o.flushInterval
+		p.Interim = func() error {
+			return o.write(p.Result(), io.Discard, io.Discard, checkTimeout, true)
+		}
+	}
 
-	// String processing to scrape phase times out of a benchmark log
-	for scanner.Scan() {
-		line := scanner.Text()
+	if o.state != "" {
+		f, err := os.Open(o.state)
 		switch {
-		case strings.Contains(line, "gcflags=all=-d=ssa/all/time=1"):
-			pwd = extractPrefixed(line, "(cd ")
-			gopath = extractPrefixed(line, "GOPATH=")
-			goroot = extractPrefixed(line, "GOROOT=")
-			i := strings.LastIndex(goroot, "/")
-			checkNN(i, "Goroot lacks trailing configuration %s", goroot)
-			cfg = intern(goroot[i+1:])
-			var ok bool
-			compilations, ok = allCompilations[cfg]
-			if !ok {
-				compilations = make(map[compilation]*allPhases)
-				allCompilations[cfg] = compilations
-			}
-
-		case strings.HasPrefix(line, "# "):
-			pkg = intern(strings.TrimSpace(line[2:]))
-
-		case strings.Contains(line, "TIME(ns)"):
-			fields := strings.Split(line, "\t")
-			for i, s := range fields {
-				fields[i] = strings.TrimSpace(s)
-			}
-			pathLCcolon := fields[0]
-			phase := phaseIndex.Index(intern(fields[1]))
-			time := fields[3]
-			funcOrMethod := intern(fields[4])
-
-			// This nonsense is to shorten and normalize names across two different benchmark runs.
-			// That turned out not to be necessary, but perhaps in a future version of this fine
-			// piece of code it will make sense to match compilation to compilation across configurations.
-			if strings.HasPrefix(pathLCcolon, "../") {
-				pwdPrefix := pwd
-				for strings.HasPrefix(pathLCcolon, "../") {
-					pathLCcolon = pathLCcolon[3:]
-					i := strings.LastIndex(pwdPrefix, "/")
-					checkNN(i, "../ removal ran out of path, originals were %s and %s", fields[0], pwd)
-					pwdPrefix = pwdPrefix[:i]
-				}
-				pathLCcolon = pwdPrefix + "/" + pathLCcolon
-			}
-			if strings.HasPrefix(pathLCcolon, gopath) {
-				pathLCcolon = "GOPATH/" + pathLCcolon[len(gopath)+1:]
-			} else if strings.HasPrefix(pathLCcolon, goroot) {
-				pathLCcolon = "GOROOT/" + pathLCcolon[len(goroot)+1:]
+		case err == nil:
+			err = p.Load(bufio.NewReader(f))
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", o.state, err)
 			}
-			pathLCcolon = intern(pathLCcolon)
+		case !errors.Is(err, os.ErrNotExist): // the first run creates it
+			return err
+		}
+	}
 
-			c := compilation{pkg: pkg, pathLCcolon: pathLCcolon, funcOrMethod: funcOrMethod}
-			t, err := strconv.ParseUint(time, 10, 64)
-			check(err, "Phase time was not an integer")
-			allphs := compilations[c]
-			if allphs == nil {
-				allphs = newAllPhases()
-				compilations[c] = allphs
+	inputs := fs.Args()
+	if len(inputs) == 0 && (o.state == "" || stdin != nil && !isTerminal(stdin)) {
+		// With -state, a piped log is appended, but a terminal is not waited on.
+		inputs = []string{"-"}
+	}
+
+	// Each input log is scanned in turn, accumulating into the same configurations.
+	// A timeout or interrupt stops the scan, but the output is still written for the
+	// compilations read so far.
+	stopped := false
+	for _, input := range inputs {
+		if err := parseFile(ctx, p, input, stdin, stderr, prog); err != nil {
+			if ctx.Err() == nil {
+				return err
 			}
-			allphs.setTime(phase, t)
-		default: // ignore
+			stopped = true
+			break
+		}
+	}
+	prog.done()
+	timedOut := checkTimeout()
+	if ctx.Err() != nil && timedOut == nil {
+		stopped = true // interrupted, perhaps as the last log ended
+	}
+	if stopped {
+		why := "interrupted"
+		if timedOut != nil {
+			why = fmt.Sprintf("timed out after %v", o.timeout)
 		}
+		fmt.Fprintf(stderr, "%s; writing the compilations read so far\n", why)
+	}
+	result := p.Result()
+	if stopped && o.state != "" {
+		// Saving part of a log would count its start twice when it is read again.
+		fmt.Fprintf(stderr, "-state %s is not updated\n", o.state)
+	} else if o.state != "" && len(inputs) > 0 {
+		// Write a new file and rename it, so a failure does not lose the old state.
+		if err := writeFile(o.state+".tmp", result.Save); err != nil {
+			return err
+		}
+		if err := os.Rename(o.state+".tmp", o.state); err != nil {
+			return err
+		}
+	}
+	if !o.quiet {
+		reportLines(stderr, result, o.verbose)
 	}
 
-	for _, m := range allCompilations {
-		for _, allphs := range m {
-			allphs.computeMedianTime()
+	if (o.since != "" || o.until != "") && result.Timestamps() == 0 {
+		fmt.Fprintf(stderr, "-since and -until had no effect: no timestamps found in the input\n")
+	}
+	var aliases []string
+	for alias := range result.ConfigAliases() {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		fmt.Fprintf(stderr, "%s: GOROOT is the same directory as %s's; merged into it\n", alias, result.ConfigAliases()[alias])
+	}
+	if n := result.Unnormalized(); n > 0 {
+		fmt.Fprintf(stderr, "%d compilations have paths with more ../ than their working directory, and are kept as logged\n", n)
+	}
+	if excluded := result.ExcludedConfigs(); len(excluded) > 0 {
+		fmt.Fprintf(stderr, "Excluded %d configurations matching %s\n", len(excluded), o.excludeConfig)
+	}
+
+	for _, x := range o.excludePhases {
+		seen := false
+		for _, p := range result.ExcludedPhases() {
+			seen = seen || p == x
+		}
+		if !seen {
+			fmt.Fprintf(stderr, "-exclude-phase %s: no such phase in the input\n", x)
 		}
 	}
 
-	for s, m := range allCompilations {
-		// Sort compilations and bin them
-		const BINS = 50
+	if timedOut != nil {
+		// The time is already up, so write everything read, then fail.
+		if err := o.write(result, stdout, stderr, func() error { return nil }, false); err != nil {
+			return err
+		}
+		return timedOut
+	}
+	return o.write(result, stdout, stderr, checkTimeout, false)
+}
+
+// write writes the reports and output files for result.  It may be called more than once,
+// for -flush-interval, with io.Discard for stdout and stderr, to rewrite the output files
+// with the compilations parsed so far.  Such an interim write skips, rather than reports,
+// the output for configurations and phases not yet seen; the final write reports them.
+func (o *options) write(result *phasetimes.Result, stdout, stderr io.Writer, checkTimeout func() error, interim bool) error {
+	if err := o.checkParsed(result); err != nil {
+		if interim {
+			return nil
+		}
+		return err
+	}
+	if o.groupByPhase == "category" {
+		categories := phasetimes.DefaultPhaseCategories()
+		if o.categoryFile != "" {
+			if err := readPhaseCategories(o.categoryFile, categories); err != nil {
+				return err
+			}
+		}
+		result = result.GroupPhases(categories)
+	}
 
-		samples := make([]*allPhases, 0, len(m))
-		for _, allphs := range m {
-			samples = append(samples, allphs)
+	var order *bufio.Writer
+	if o.dumpOrder != "" {
+		f, err := os.Create(o.dumpOrder)
+		if err != nil {
+			return fmt.Errorf("could not open -dump-order output: %w", err)
 		}
+		defer f.Close()
+		order = bufio.NewWriter(f)
+		defer order.Flush()
+		fmt.Fprintf(order, "config\tindex\tpackage\tpath\tfunc\ttotal\n")
+	}
 
-		sort.Slice(samples, func(i, j int) bool {
-			si, sj := samples[i], samples[j]
-			if si.total != sj.total {
-				return si.total < sj.total
+	phases := result.Phases()
+	var columns []int
+	if len(o.phases) > 0 {
+		columns = selectPhases(stderr, phases, o.phases)
+	}
+	if o.phaseOrder != "firstseen" {
+		if columns == nil {
+			columns = make([]int, len(phases))
+			for i := range columns {
+				columns[i] = i
 			}
-			return si.median < sj.median
+		}
+		if o.phaseOrder == "alpha" {
+			sort.Slice(columns, func(i, j int) bool {
+				return phases[columns[i]] < phases[columns[j]]
+			})
+		} else {
+			totals := result.PhaseTotals()
+			sort.SliceStable(columns, func(i, j int) bool {
+				return totals[columns[i]] > totals[columns[j]]
+			})
+		}
+	}
+	if o.phaseDict != "" {
+		err := writeFile(o.phaseDict, func(w io.Writer) error {
+			return writePhaseDict(w, phases, columns)
 		})
+		if err != nil {
+			return err
+		}
+	}
+
+	sortBy := -1
+	if o.sortBy != "" {
+		for i, p := range phases {
+			if p == o.sortBy {
+				sortBy = i
+			}
+		}
+		if sortBy < 0 {
+			if interim {
+				return nil
+			}
+			return fmt.Errorf("-sortby %s: no such phase, phases are %s", o.sortBy, strings.Join(phases, ", "))
+		}
+	}
+
+	configs := result.Configs()
+	if len(o.configs) > 0 || o.configRE != nil {
+		var selected []string
+		for _, s := range configs {
+			if o.wantConfig(s) {
+				selected = append(selected, s)
+			}
+		}
+		if len(selected) == 0 {
+			if interim {
+				return nil
+			}
+			return fmt.Errorf("no configurations match -config or -config-regex; saw %s", strings.Join(configs, ", "))
+		}
+		configs = selected
+	}
+	o.nameFiles(configs)
+
+	// The reports go to standard output, unless that is where -stdout writes the CSV.
+	report := stdout
+	if o.stdout {
+		report = stderr
+	}
+
+	if o.phaseAudit {
+		missing := result.MissingPhases(configs)
+		for _, m := range missing {
+			fmt.Fprintf(report, "phase audit: %s: no times in %s\n", phases[m.Phase], strings.Join(m.Missing, ", "))
+		}
+		if len(missing) == 0 {
+			fmt.Fprintf(report, "phase audit: all %d phases timed in all %d configurations\n", len(phases), len(configs))
+		}
+	}
+
+	if o.diff != "" {
+		ab := strings.Split(o.diff, ",")
+		if len(ab) != 2 {
+			return fmt.Errorf("-diff wants two comma-separated configurations, not %s", o.diff)
+		}
+		err := checkConfigs(result, ab, "-diff "+o.diff)
+		if err == nil {
+			reportDiff(report, ab[0], ab[1], phases, result.Diff(ab[0], ab[1]), o.unitSuffix())
+		} else if !interim {
+			return err
+		}
+	}
+
+	if len(o.align) > 0 {
+		err := checkConfigs(result, o.align, "-align")
+		if err == nil {
+			aligned, unmatched := result.Align(o.align)
+			for k, c := range o.align {
+				fmt.Fprintf(stderr, "-align: %s: %d compilations matched, %d unmatched\n", c, len(aligned), unmatched[k])
+			}
+			csvOpts := phasetimes.CSVOptions{Columns: columns, Unit: o.unitKind, Metric: o.metricKind, Comma: o.comma}
+			err := writeFile(o.configFile(strings.Join(o.align, "-"), ".aligned.csv"), func(w io.Writer) error {
+				return phasetimes.WriteAlignedCSV(w, o.align, phases, aligned, csvOpts)
+			})
+			if err != nil {
+				return err
+			}
+		} else if !interim {
+			return err
+		}
+	}
+
+	if o.stdout && len(configs) > 1 {
+		return fmt.Errorf("-stdout writes only one configuration, but there are %d (%s); choose one with -config", len(configs), strings.Join(configs, ", "))
+	}
+
+	var combined *phasetimes.CombinedCSVWriter
+	var combinedRaw *phasetimes.RawCSVWriter
+	if o.combined != "" {
+		f, err := os.Create(o.combined)
+		if err != nil {
+			return fmt.Errorf("could not open -combined output: %w", err)
+		}
+		defer f.Close()
+		if o.raw {
+			combinedRaw = phasetimes.NewRawCSVWriter(f)
+		} else {
+			combined = phasetimes.NewCombinedCSVWriter(f)
+		}
+	}
+
+	// Sort compilations and bin them, for all configurations in parallel;
+	// the results are then reported and written in order.
+	work, err := o.sortAndBin(result, configs)
+	if err != nil {
+		return err
+	}
+
+	explained := false
+	for k, s := range configs {
+		if err := checkTimeout(); err != nil {
+			return err
+		}
+		if base := o.bases[s]; base != s {
+			fmt.Fprintf(stderr, "%q: output files are named %s.*\n", s, base)
+		}
+		samples, incomplete, small := work[k].Samples, work[k].Incomplete, work[k].Small
+		if incomplete > 0 {
+			fmt.Fprintf(stderr, "%s: excluded %d of %d compilations with fewer than %d nonzero phases\n", s, incomplete, len(samples)+incomplete+small, o.requirePhases)
+		}
+		if small > 0 {
+			fmt.Fprintf(stderr, "%s: excluded %d of %d compilations with total below %dns\n", s, small, len(samples)+incomplete+small, o.minTotal)
+		}
+
+		if len(samples) > 0 && samples[len(samples)/2].Total < o.unitWarn {
+			fmt.Fprintf(stderr, "%s: median compilation total is only %dns, are the phase times really in ns?\n", s, samples[len(samples)/2].Total)
+		}
+
+		if order != nil {
+			for i, sample := range samples {
+				c := sample.Compilation
+				fmt.Fprintf(order, "%s\t%d\t%s\t%s\t%s\t%d\n", s, i, c.Pkg, c.Path, c.Func, sample.Total)
+			}
+		}
+
+		if o.top > 0 {
+			reportTop(report, s, phases, samples, o.top, o.unitSuffix())
+		}
+		if o.explain != "" && reportExplain(stderr, work[k], o.explainPkg, o.explainFunc) {
+			explained = true
+		}
+
+		csvOpts := phasetimes.CSVOptions{ShareDrift: o.shareDrift, Stat: o.statKind, Columns: columns, SortBy: o.sortBy, Absolute: o.absolute, Unit: o.unitKind, Metric: o.metricKind, Stats: o.stats, Edges: o.edges, Cumulative: o.cumulative, Comma: o.comma}
+		if o.percentiles {
+			err := writeFile(o.configFile(s, ".percentiles.csv"), func(w io.Writer) error {
+				return phasetimes.WritePercentilesCSV(w, s, phases, samples, csvOpts)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if o.groupBy == "package" {
+			err := o.writeOutput(stdout, o.configFile(s, ".package.csv"), func(w io.Writer) error {
+				return phasetimes.WritePackageCSV(w, s, phases, result.ByPackage(samples), csvOpts)
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if o.raw {
+			var err error
+			if combinedRaw != nil {
+				err = combinedRaw.Write(s, phases, samples, csvOpts)
+			} else {
+				err = o.writeOutput(stdout, o.configFile(s, ".raw.csv"), func(w io.Writer) error {
+					raw := phasetimes.NewRawCSVWriter(w)
+					if err := raw.Write(s, phases, samples, csvOpts); err != nil {
+						return err
+					}
+					return raw.Flush()
+				})
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
-		bins := make([]*allPhases, BINS, BINS)
-		binsize := float64(len(samples)) / BINS
-		binI := 0
-		for a := 0.0; a < float64(len(samples)); a += binsize {
-			next := a + binsize
-			bin := newAllPhases()
-			for i := int(a); i < int(next); i++ {
-				sample := samples[i]
-				bin.median += sample.median
-				bin.total += sample.total
-				for j, t := range sample.phases {
-					bin.phases[j] += t
+		if o.format == "benchstat" || o.format == "folded" {
+			err := o.writeOutput(stdout, o.configFile(s, "."+o.format), func(w io.Writer) error {
+				if o.format == "folded" {
+					return phasetimes.WriteFolded(w, s, phases, samples, csvOpts)
 				}
+				return phasetimes.WriteBenchstat(w, s, phases, samples, csvOpts)
+			})
+			if err != nil {
+				return err
 			}
-			bin.computeMedianTime() // Something very flaky -- there are many w/ median == 0
-			bins[binI] = bin
-			binI++
+			continue
 		}
 
-		f, err := os.Create(s + ".csv")
-		check(err, "Could not open file for csv output")
-		csvw := csv.NewWriter(f)
+		if o.edges == nil && o.bins > len(samples) {
+			fmt.Fprintf(stderr, "%s: only %d compilations, using %d bins instead of %d\n", s, len(samples), len(samples), o.bins)
+		}
+		bins, ranges := work[k].Bins, work[k].Ranges
 
-		title := []string{fmt.Sprintf("%s:Binned compilation phase timing profiles, bin total of phase times / bin total of per-compilation median phase times", s)}
-		for i := 0; i < int(phaseIndex.NextIndex()); i++ {
-			title = append(title, phaseIndex.String(int32(i)))
+		if o.checkMonotone {
+			reportMonotone(report, s, phases, bins)
+		}
+		if o.hotFactor > 0 {
+			hot := phasetimes.HotPhases(bins, len(phases), o.hotFactor)
+			err := writeFile(o.configFile(s, ".hotphases.txt"), func(w io.Writer) error {
+				return writeHotPhases(w, s, phases, hot)
+			})
+			if err != nil {
+				return err
+			}
 		}
-		title = append(title, "TOTAL (ns)")
-		csvw.Write(title)
 
-		phaseTotals := make([]phaseTime, phaseIndex.NextIndex()+1)
+		if o.summary {
+			err := writeFile(o.configFile(s, ".summary.csv"), func(w io.Writer) error {
+				return phasetimes.WriteSummaryCSV(w, s, phases, bins, csvOpts)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if o.culprits {
+			err := writeFile(o.configFile(s, ".culprits.csv"), func(w io.Writer) error {
+				return phasetimes.WriteCulpritsCSV(w, s, phases, bins, ranges, csvOpts)
+			})
+			if err != nil {
+				return err
+			}
+		}
 
-		binI = 0
-		for a := 0.0; a < float64(len(samples)); a += binsize {
-			ia := int64(a)
-			next := int64(a + binsize)
-			row := []string{}
-			row = append(row, fmt.Sprintf("[%d,%d)", ia, next))
-			b := bins[binI]
-			for i := 0; i < int(phaseIndex.NextIndex()); i++ {
-				row = append(row, fmt.Sprintf("%5.2f", float64(b.phases[i])/float64(b.median)))
-				phaseTotals[i] += b.phases[i]
+		var err error
+		switch {
+		case combined != nil:
+			err = combined.Write(s, phases, bins, ranges, csvOpts)
+		case o.format == "json":
+			err = o.writeOutput(stdout, o.configFile(s, ".json"), func(w io.Writer) error {
+				return phasetimes.WriteJSON(w, s, phases, bins, ranges, o.statKind)
+			})
+		case o.format == "html":
+			err = o.writeOutput(stdout, o.configFile(s, ".html"), func(w io.Writer) error {
+				return phasetimes.WriteHTML(w, s, phases, bins, ranges, csvOpts)
+			})
+		case o.format == "gnuplot":
+			err = writeFile(o.configFile(s, ".dat"), func(w io.Writer) error {
+				return phasetimes.WriteGnuplotData(w, s, phases, bins, csvOpts)
+			})
+			if err == nil {
+				err = writeFile(o.configFile(s, ".gp"), func(w io.Writer) error {
+					return phasetimes.WriteGnuplotScript(w, s, filepath.Base(o.configFile(s, ".dat")), phases, csvOpts)
+				})
 			}
-			row = append(row, fmt.Sprintf("%5.2f", float64(b.total)))
-			csvw.Write(row)
-			binI++
+		case o.format == "md":
+			err = o.writeOutput(stdout, o.configFile(s, ".md"), func(w io.Writer) error {
+				return phasetimes.WriteMarkdown(w, s, phases, bins, ranges, csvOpts)
+			})
+		default:
+			err = o.writeOutput(stdout, o.configFile(s, ".csv"), func(w io.Writer) error {
+				return phasetimes.WriteCSV(w, s, phases, bins, ranges, csvOpts)
+			})
+		}
+		if err != nil {
+			return err
 		}
+	}
 
-		row := []string{}
-		row = append(row, fmt.Sprintf("PHASE TOTALS (ns)"))
-		total := phaseTime(0)
-		for i := 0; i < int(phaseIndex.NextIndex()); i++ {
-			total += phaseTotals[i]
-			row = append(row, fmt.Sprintf("%d", phaseTotals[i]))
+	if o.explain != "" && !explained {
+		fmt.Fprintf(stderr, "-explain %s: no such compilation among those binned\n", o.explain)
+	}
+	if combined != nil {
+		if err := combined.Flush(); err != nil {
+			return fmt.Errorf("could not write -combined output: %w", err)
+		}
+	}
+	if combinedRaw != nil {
+		if err := combinedRaw.Flush(); err != nil {
+			return fmt.Errorf("could not write -combined output: %w", err)
+		}
+	}
+	if order != nil {
+		if err := order.Flush(); err != nil {
+			return fmt.Errorf("could not write -dump-order output: %w", err)
 		}
-		row = append(row, fmt.Sprintf("%d", total))
-		csvw.Write(row)
+	}
+	return nil
+}
 
-		csvw.Flush()
-		f.Close()
+// checkConfigs returns an error, prefixed by flag, naming the first of configs not in result.
+func checkConfigs(result *phasetimes.Result, configs []string, flag string) error {
+	for _, c := range configs {
+		if result.Compilations(c) == nil {
+			return fmt.Errorf("%s: no configuration %s; saw %s", flag, c, strings.Join(result.Configs(), ", "))
+		}
 	}
+	return nil
+}
 
-	//out.Flush()
-	check(scanner.Err(), "Problem reading (scanning) standard input")
+// checkParsed returns an error if result holds no phase timings, describing what was missing
+// from the input, since that usually means the log was not in the expected format.
+func (o *options) checkParsed(result *phasetimes.Result) error {
+	configs := result.Configs()
+	if len(configs) == 0 {
+		if len(result.ExcludedConfigs()) > 0 {
+			return fmt.Errorf("no data: every configuration was excluded by -exclude-config-regex")
+		}
+		if o.marker != "" {
+			return fmt.Errorf("no data: no compile command lines found; expected lines containing the -marker %s", o.marker)
+		}
+		return fmt.Errorf("no data: no compile command lines found; expected lines containing gcflags=all=-d=ssa/all/time=1 (or time=2, or either without all=), or some other -marker")
+	}
+	for _, s := range configs {
+		if len(result.Compilations(s)) > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("no data: no phase timing lines found; expected lines containing TIME(ns)")
 }
 
-type compilation struct {
-	pkg, pathLCcolon, funcOrMethod string
+// sortAndBin sorts and bins the compilations of each of configs, using up to o.jobs goroutines.
+// The configurations are independent, and the phase index is only read.
+func (o *options) sortAndBin(result *phasetimes.Result, configs []string) ([]*phasetimes.Profile, error) {
+	opts := phasetimes.BinOptions{Bins: o.bins, Stat: o.statKind, Mode: o.binModeKind, Edges: o.edges, SortBy: o.sortBy, RequirePhases: o.requirePhases, MinTotal: o.minTotal}
+	if o.raw || o.groupBy != "" {
+		opts.Bins, opts.Edges = 0, nil
+	}
+	work := make([]*phasetimes.Profile, len(configs))
+	errs := make([]error, len(configs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < o.jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				work[k], errs[k] = result.Binned(configs[k], opts)
+			}
+		}()
+	}
+	for k := range configs {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return work, nil
 }
 
-type allPhases struct {
-	total, median uint64
-	phases        []phaseTime
+// wantConfig reports whether configuration cfg was selected by -config or -config-regex.
+func (o *options) wantConfig(cfg string) bool {
+	if o.configRE != nil && o.configRE.MatchString(cfg) {
+		return true
+	}
+	for _, c := range o.configs {
+		prefix, suffix := strings.HasSuffix(c, "*"), strings.HasPrefix(c, "*")
+		c = strings.Trim(c, "*")
+		switch {
+		case prefix && suffix:
+			if strings.Contains(cfg, c) {
+				return true
+			}
+		case prefix:
+			if strings.HasPrefix(cfg, c) {
+				return true
+			}
+		case suffix:
+			if strings.HasSuffix(cfg, c) {
+				return true
+			}
+		case cfg == c:
+			return true
+		}
+	}
+	return false
 }
 
-func (aph *allPhases) setTime(phase int32, time uint64) {
-	if time == 0 {
-		return
+// isTerminal reports whether f is a terminal (or other character device, such as /dev/null).
+func isTerminal(f interface{}) bool {
+	file, ok := f.(*os.File)
+	if !ok {
+		return false
 	}
-	for len(aph.phases) <= int(phase) {
-		aph.phases = append(aph.phases, 0)
+	fi, err := file.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// parseFile parses the log named input, or stdin if input is "-".
+// If prog is not nil, it is told how much of a file input has been read.
+func parseFile(ctx context.Context, p *phasetimes.Parser, input string, stdin io.Reader, stderr io.Writer, prog *progress) error {
+	if input == "-" {
+		r, err := maybeGunzip(stdin, false)
+		if err != nil {
+			return fmt.Errorf("could not decompress standard input: %w", err)
+		}
+		return p.Parse(ctx, "standard input", r)
 	}
-	if aph.phases[phase] != 0 {
-		return
+	f, err := os.Open(input) // Simplify life for running under a debugger, also use arg as input file.
+	if err != nil {
+		return fmt.Errorf("could not open input: %w", err)
 	}
-	aph.phases[phase] = phaseTime(time)
-	aph.total += time
+	defer f.Close()
+	var in io.Reader = f
+	if prog != nil {
+		prog.read, prog.size = 0, 0
+		if fi, err := f.Stat(); err == nil {
+			prog.size = fi.Size()
+		}
+		in = &countingReader{r: f, n: &prog.read}
+	}
+	if strings.HasSuffix(input, ".zip") {
+		if prog != nil {
+			prog.size = 0 // entries are read out of order
+		}
+		return parseZip(ctx, p, input, f, stderr)
+	}
+	tarball := strings.HasSuffix(input, ".tar") || strings.HasSuffix(input, ".tar.gz") || strings.HasSuffix(input, ".tgz")
+	r, err := maybeGunzip(in, strings.HasSuffix(input, ".gz") || strings.HasSuffix(input, ".tgz"))
+	if err != nil {
+		return fmt.Errorf("could not decompress %s: %w", input, err)
+	}
+	if tarball {
+		return parseTar(ctx, p, input, r, stderr)
+	}
+	return p.Parse(ctx, input, r)
 }
 
-func (aph *allPhases) medianTime() uint64 {
-	if aph.median == 0 {
-		aph.computeMedianTime()
+// parseZip parses each log in the zip archive f, named input, as if it were named on the
+// command line as input/<entry>.  Directories and entries that are not text are skipped.
+func parseZip(ctx context.Context, p *phasetimes.Parser, input string, f *os.File, stderr io.Writer) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
 	}
-	return aph.median
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", input, err)
+	}
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		name := input + "/" + zf.Name
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", name, err)
+		}
+		err = parseEntry(ctx, p, name, rc, stderr)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (aph *allPhases) computeMedianTime() {
-	l := len(aph.phases)
-	scratch := make([]phaseTime, 0, l)
-	scratch = append(scratch, aph.phases...)
-	sort.Slice(scratch, func(i, j int) bool {
-		return scratch[i] < scratch[j]
-	})
-	// check median A={x,y} => (A[2/2]+A[(1/2)])/2
-	// check median A={x,y,z} => (A[3/2]+A[(2/2)])/2
-	aph.median = uint64(scratch[l/2]+scratch[(l-1)/2]) / 2
+// parseTar is like parseZip, for the tar archive read from r.
+func parseTar(ctx context.Context, p *phasetimes.Parser, input string, r io.Reader, stderr io.Writer) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", input, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := parseEntry(ctx, p, input+"/"+hdr.Name, tr, stderr); err != nil {
+			return err
+		}
+	}
+}
+
+// parseEntry parses the archive entry name, read from r, decompressing it if it is gzipped,
+// unless it does not look like text.
+func parseEntry(ctx context.Context, p *phasetimes.Parser, name string, r io.Reader, stderr io.Writer) error {
+	r, err := maybeGunzip(r, strings.HasSuffix(name, ".gz"))
+	if err != nil {
+		return fmt.Errorf("could not decompress %s: %w", name, err)
+	}
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(512); bytes.IndexByte(head, 0) >= 0 {
+		fmt.Fprintf(stderr, "%s: skipping, not a text log\n", name)
+		return nil
+	}
+	return p.Parse(ctx, name, br)
 }
 
-type phaseTime uint64
+// A progress prints a line about once a second while logs are parsed.
+type progress struct {
+	w       io.Writer
+	last    time.Time
+	result  *phasetimes.Result
+	read    int64 // bytes of the current file read so far
+	size    int64 // size of the current file, zero if unknown
+	printed bool
+}
 
-type stringIndex struct {
-	m map[string]int32
-	i []string
+func (pr *progress) report(name string, lines int) {
+	if time.Since(pr.last) < time.Second {
+		return
+	}
+	pr.last = time.Now()
+	configs := pr.result.Configs()
+	n := 0
+	for _, c := range configs {
+		n += len(pr.result.Compilations(c))
+	}
+	pct := ""
+	if pr.size > 0 {
+		pct = fmt.Sprintf(" (%d%%)", 100*pr.read/pr.size)
+	}
+	fmt.Fprintf(pr.w, "\r%s: %d lines%s, %d compilations, %d configurations", name, lines, pct, n, len(configs))
+	pr.printed = true
 }
 
-func (x *stringIndex) Index(s string) int32 {
-	i, ok := x.m[s]
-	if !ok {
-		i = int32(len(x.i))
-		x.m[s] = i
-		x.i = append(x.i, s)
+// done ends the progress line, if one was printed.
+func (pr *progress) done() {
+	if pr != nil && pr.printed {
+		fmt.Fprintln(pr.w)
 	}
-	return i
 }
 
-func (x *stringIndex) String(i int32) string {
-	return x.i[i]
+// A countingReader counts the bytes read from r into *n.
+type countingReader struct {
+	r io.Reader
+	n *int64
 }
 
-func (x *stringIndex) NextIndex() int32 {
-	return int32(len(x.i))
+func (c *countingReader) Read(b []byte) (int, error) {
+	k, err := c.r.Read(b)
+	*c.n += int64(k)
+	return k, err
 }
 
-func newStringIndex() *stringIndex {
-	return &stringIndex{m: make(map[string]int32)}
+// configFile returns the name of the output file for configuration cfg with the given suffix,
+// in the -out directory.
+func (o *options) configFile(cfg, suffix string) string {
+	base, ok := o.bases[cfg]
+	if !ok {
+		base = fileBase(cfg)
+	}
+	return filepath.Join(o.outDir, base+suffix)
 }
 
-var internedStrings = make(map[string]string)
+// nameFiles sets o.bases to the base of the output file names of each of configs: its
+// fileBase, unless another configuration's is the same, ignoring case as some file systems
+// do.  Then the configuration whose fileBase is its own name keeps it, and the others are
+// numbered -2, -3, ... in order, rather than overwriting one another's files.
+func (o *options) nameFiles(configs []string) {
+	o.bases = make(map[string]string, len(configs))
+	used := make(map[string]bool)
+	for _, cfg := range configs {
+		if fileBase(cfg) == cfg && !used[strings.ToLower(cfg)] {
+			o.bases[cfg] = cfg
+			used[strings.ToLower(cfg)] = true
+		}
+	}
+	for _, cfg := range configs {
+		if _, ok := o.bases[cfg]; ok {
+			continue
+		}
+		base := fileBase(cfg)
+		for n := 2; used[strings.ToLower(base)]; n++ {
+			base = fmt.Sprintf("%s-%d", fileBase(cfg), n)
+		}
+		o.bases[cfg] = base
+		used[strings.ToLower(base)] = true
+	}
+}
 
-func intern(s string) string {
-	if r, ok := internedStrings[s]; ok {
-		return r
+// fileBase returns cfg with any character that is unsafe in a file name (path separators,
+// spaces, colons, control characters, ...) replaced by an underscore, for use as a file name
+// that stays in the output directory.  An empty cfg, as from -rename, is named "config".
+func fileBase(cfg string) string {
+	if cfg == "" {
+		return "config"
 	}
-	internedStrings[s] = s
-	return s
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case r == '.' || r == '-' || r == '_' || r == '+':
+			return r
+		}
+		return '_'
+	}, cfg)
 }
 
-// extractPrefixed ensures that line begins with prefix, and returns the space-ended word
-// that immediately follows prefix.  Trailing semicolon and slash are removed, and the
-// result is de-duplicated (interned).
-func extractPrefixed(line, prefix string) string {
-	i := strings.Index(line, prefix)
-	checkNN(i, "Compile line is missing %s prefixed string, line = %s", prefix, line)
-	goroot := line[i+len(prefix):]
-	i = strings.Index(goroot, " ")
-	goroot = goroot[:i]
-	if goroot[len(goroot)-1] == ';' { // easy extension to cd case
-		goroot = goroot[:len(goroot)-1]
+// unitSuffix returns the suffix of the -metric values in reports: ns for times, or the
+// name of what is counted, after a space.
+func (o *options) unitSuffix() string {
+	if o.metricKind != phasetimes.MetricTime {
+		return " " + o.metricKind.String()
 	}
-	if goroot[len(goroot)-1] == '/' {
-		goroot = goroot[:len(goroot)-1]
+	return "ns"
+}
+
+// writeOutput writes the main output for a configuration with write, to stdout if -stdout
+// was given and otherwise to the file name.
+func (o *options) writeOutput(stdout io.Writer, name string, write func(w io.Writer) error) error {
+	if o.stdout {
+		if err := write(stdout); err != nil {
+			return fmt.Errorf("could not write to standard output: %w", err)
+		}
+		return nil
 	}
-	return intern(goroot)
+	return writeFile(name, write)
 }
 
-// check ensures that err is nil.
-// If not, it uses the additional parameters to form a an error message before panicking.
-func check(err error, messages ...interface{}) {
+// writeFile creates the file name and fills it in with write.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
 	if err != nil {
-		if len(messages) > 0 {
-			maybeFmt := messages[0]
-			if fm, ok := maybeFmt.(string); ok && len(messages) > 1 {
-				fmt.Printf(fm, messages[1:]...)
-				fmt.Println()
-			} else {
-				fmt.Println(maybeFmt)
+		return fmt.Errorf("could not open file for output: %w", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	return nil
+}
+
+// selectPhases returns the phase numbers of the phases named in selected,
+// warning about any names that are not phases.
+func selectPhases(stderr io.Writer, phases, selected []string) []int {
+	columns := []int{}
+	for _, name := range selected {
+		found := false
+		for i, p := range phases {
+			if p == name {
+				columns = append(columns, i)
+				found = true
+				break
 			}
 		}
-		panic(err)
+		if !found {
+			fmt.Fprintf(stderr, "-phase %s: no such phase, phases are %s\n", name, strings.Join(phases, ", "))
+		}
 	}
+	return columns
 }
 
-// checkNN ensures that i is not negative.
-// If not, it uses the additional parameters to form a an error message before panicking.
-func checkNN(i int, messages ...interface{}) {
-	if i < 0 {
-		if len(messages) > 0 {
-			maybeFmt := messages[0]
-			if fm, ok := maybeFmt.(string); ok && len(messages) > 1 {
-				fmt.Printf(fm, messages[1:]...)
-				fmt.Println()
-			} else {
-				fmt.Println(maybeFmt)
+// readPhaseCategories adds the phase categories in file name, one tab-separated phase name
+// and category per line, to categories.  Blank lines and lines beginning with # are skipped.
+func readPhaseCategories(name string, categories map[string]string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("could not read -phase-categories: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 2 || strings.TrimSpace(f[0]) == "" || strings.TrimSpace(f[1]) == "" {
+			return fmt.Errorf("%s:%d: expected a phase and a category separated by a tab", name, i+1)
+		}
+		categories[strings.TrimSpace(f[0])] = strings.TrimSpace(f[1])
+	}
+	return nil
+}
+
+// writePhaseDict writes one line for each phase column, in the order given by columns
+// (all phases if nil), with its position among the phase columns and its name.
+func writePhaseDict(w io.Writer, phases []string, columns []int) error {
+	for k := range phases {
+		if columns != nil && k >= len(columns) {
+			break
+		}
+		i := k
+		if columns != nil {
+			i = columns[k]
+		}
+		if _, err := fmt.Fprintf(w, "%d\t%s\n", k, phases[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stringList is a flag.Value for a list of strings, given either
+// by repeating the flag or as a comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, strings.Split(s, ",")...)
+	return nil
+}
+
+// reportLines prints the number of lines parsed and the configurations, compilations, and
+// phases found in them, and with verbose, how the lines were understood.
+func reportLines(w io.Writer, result *phasetimes.Result, verbose bool) {
+	n := 0
+	for _, c := range result.Configs() {
+		n += len(result.Compilations(c))
+	}
+	lc := result.LineCounts()
+	fmt.Fprintf(w, "Parsed %d lines: %d configurations, %d compilations, %d phases\n", lc.Lines, len(result.Configs()), n, result.NumPhases())
+	if verbose {
+		fmt.Fprintf(w, "\t%d compile commands, %d packages, %d phase times, %d excluded, %d blank, %d ignored\n",
+			lc.Compile, lc.Package, lc.Time, lc.Excluded, lc.Blank, lc.Ignored)
+	}
+	if lc.Limited > 0 {
+		fmt.Fprintf(w, "%d phase times of compilations beyond -limit or -sample were ignored\n", lc.Limited)
+	}
+}
+
+// reportMonotone prints, for each phase, how often its ratio decreases from one bin to the next.
+// A phase with genuinely non-linear cost should rise steadily; frequent or large drops suggest
+// the bins are dominated by noise.
+func reportMonotone(w io.Writer, cfg string, phases []string, bins []*phasetimes.PhaseSet) {
+	for i, name := range phases {
+		steps, drops := 0, 0
+		worst := 0.0
+		prev := math.NaN()
+		for _, b := range bins {
+			if b == nil || b.Norm == 0 || i >= len(b.Phases) {
+				continue
 			}
+			r := float64(b.Phases[i]) / float64(b.Norm)
+			if !math.IsNaN(prev) {
+				steps++
+				if r < prev {
+					drops++
+					worst = math.Max(worst, prev-r)
+				}
+			}
+			prev = r
+		}
+		if drops == 0 {
+			fmt.Fprintf(w, "%s: %s: monotone over %d steps\n", cfg, name, steps)
+		} else {
+			fmt.Fprintf(w, "%s: %s: NOT monotone, decreases at %d of %d steps, largest drop %5.2f\n", cfg, name, drops, steps, worst)
+		}
+	}
+}
+
+// reportDiff prints the comparison d of configurations a and b, with unit after each delta.
+func reportDiff(w io.Writer, a, b string, phases []string, d *phasetimes.Diff, unit string) {
+	fmt.Fprintf(w, "%s vs %s: %d compilations in both\n", a, b, d.Common)
+	for _, p := range d.Phases {
+		switch {
+		case p.A == 0 && p.B == 0:
+			fmt.Fprintf(w, "%s vs %s: %s: absent from both\n", a, b, phases[p.Phase])
+		case p.A == 0:
+			fmt.Fprintf(w, "%s vs %s: %s: new in %s, delta %+d%s\n", a, b, phases[p.Phase], b, p.Delta(), unit)
+		default:
+			fmt.Fprintf(w, "%s vs %s: %s: %s/%s %5.3f, delta %+d%s\n", a, b, phases[p.Phase], b, a, p.Ratio(), p.Delta(), unit)
+		}
+	}
+	for _, c := range d.OnlyA {
+		fmt.Fprintf(w, "%s vs %s: only in %s: %s %s %s\n", a, b, a, c.Pkg, c.Path, c.Func)
+	}
+	for _, c := range d.OnlyB {
+		fmt.Fprintf(w, "%s vs %s: only in %s: %s %s %s\n", a, b, b, c.Pkg, c.Path, c.Func)
+	}
+}
+
+// reportTop prints the n compilations in samples with the largest total time, and the phase
+// that contributed most to each, with unit after each value.
+func reportTop(w io.Writer, cfg string, phases []string, samples []*phasetimes.PhaseSet, n int, unit string) {
+	sorted := append([]*phasetimes.PhaseSet(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Total > sorted[j].Total
+	})
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	for k, sample := range sorted[:n] {
+		c := sample.Compilation
+		fmt.Fprintf(w, "%s: %d: %s %s %s: total %d%s", cfg, k+1, c.Pkg, c.Path, c.Func, sample.Total, unit)
+		top := -1
+		for i, t := range sample.Phases {
+			if t > 0 && (top < 0 || t > sample.Phases[top]) {
+				top = i
+			}
+		}
+		if top >= 0 {
+			fmt.Fprintf(w, ", most in %s (%d%s)", phases[top], sample.Phases[top], unit)
 		}
-		panic("Expected non-negative")
+		fmt.Fprintln(w)
+	}
+}
+
+// reportExplain prints, for each compilation of prof in package pkg named fn, its phase times
+// and median, the bin it was assigned to, and its part in each of that bin's ratios, its phase
+// time over the bin's Norm; a bin's ratio is the sum of those parts over its compilations.
+// It reports whether there were any such compilations.
+func reportExplain(w io.Writer, prof *phasetimes.Profile, pkg, fn string) bool {
+	found := false
+	for i, sample := range prof.Samples {
+		c := sample.Compilation
+		if c.Pkg != pkg || c.Func != fn {
+			continue
+		}
+		found = true
+		fmt.Fprintf(w, "%s: explain %s %s %s: total %dns, median phase time %dns, %d of %d compilations in sorted order\n",
+			prof.Config, c.Pkg, c.Path, c.Func, sample.Total, sample.Median, i+1, len(prof.Samples))
+		bin := -1
+		for j, r := range prof.Ranges {
+			if i >= r[0] && i < r[1] {
+				bin = j
+			}
+		}
+		var b *phasetimes.PhaseSet
+		if bin >= 0 {
+			b = prof.Bins[bin]
+			r := prof.Ranges[bin]
+			fmt.Fprintf(w, "\tbin %d: compilations [%d,%d), totals %dns to %dns, norm %dns\n", bin, r[0], r[1], b.MinTotal, b.MaxTotal, b.Norm)
+		}
+		for j, name := range prof.Phases {
+			var t phasetimes.PhaseTime
+			if j < len(sample.Phases) {
+				t = sample.Phases[j]
+			}
+			if b == nil || b.Norm == 0 {
+				fmt.Fprintf(w, "\t%s\t%dns\n", name, t)
+				continue
+			}
+			fmt.Fprintf(w, "\t%s\t%dns\t%.4f of the bin's ratio %.4f\n", name, t, float64(t)/float64(b.Norm), prof.Ratios[bin][j])
+		}
+	}
+	return found
+}
+
+// writeHotPhases writes one line for each of the suspicious phases in hot.
+func writeHotPhases(w io.Writer, cfg string, phases []string, hot []phasetimes.HotPhase) error {
+	if len(hot) == 0 {
+		_, err := fmt.Fprintf(w, "%s: no phases look nonlinear\n", cfg)
+		return err
+	}
+	for _, h := range hot {
+		monotone := ""
+		if h.Monotone {
+			monotone = ", monotone"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: grows %5.2fx, ratio %5.2f to %5.2f, slope %6.3f per bin%s\n",
+			cfg, phases[h.Phase], h.Growth, h.First, h.Last, h.Slope, monotone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maybeGunzip returns a reader for the uncompressed contents of r.
+// If gz is set, r must be gzip-compressed, otherwise the gzip magic number is sniffed.
+func maybeGunzip(r io.Reader, gz bool) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if !gz {
+		magic, err := br.Peek(2)
+		gz = err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+	}
+	if gz {
+		return gzip.NewReader(br)
 	}
+	return br, nil
 }
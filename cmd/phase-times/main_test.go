@@ -0,0 +1,104 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dr2chase/gc-phase-times/phasetimes"
+)
+
+func TestNameFiles(t *testing.T) {
+	o := &options{}
+	o.nameFiles([]string{"a b", "a_b", "Base", "base", "x/y"})
+	want := map[string]string{"a b": "a_b-2", "a_b": "a_b", "Base": "Base", "base": "base-2", "x/y": "x_y"}
+	for cfg, base := range want {
+		if got := o.bases[cfg]; got != base {
+			t.Errorf("%q is written to %s.*, want %s.*", cfg, got, base)
+		}
+	}
+}
+
+func TestStateReadsStdin(t *testing.T) {
+	log, err := os.ReadFile(filepath.Join("testdata", "small.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	state := filepath.Join(dir, "st.gob")
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-quiet", "-out", dir, "-state", state}, bytes.NewReader(log), &stdout, &stderr); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.Bytes())
+	}
+	if _, err := os.Stat(state); err != nil {
+		t.Errorf("-state with a log on standard input did not save it: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Base.csv")); err != nil {
+		t.Errorf("-state with a log on standard input wrote no output: %v", err)
+	}
+}
+
+// TestInterimSkipsUnseen flushes while only the first of two configurations has been read,
+// with -config and -diff naming the second; the interim writes must not end the run.
+func TestInterimSkipsUnseen(t *testing.T) {
+	log, err := os.ReadFile(filepath.Join("testdata", "small.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := bytes.Index(log[1:], []byte("(cd ")) + 1
+	r, w := io.Pipe()
+	go func() {
+		w.Write(log[:second])
+		time.Sleep(50 * time.Millisecond)
+		w.Write(log[second:])
+		w.Close()
+	}()
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	args := []string{"-quiet", "-out", dir, "-flush-interval", "5ms", "-config", "Test", "-diff", "Base,Test"}
+	if err := run(args, r, &stdout, &stderr); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.Bytes())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Test.csv")); err != nil {
+		t.Errorf("no output for the configuration read last: %v", err)
+	}
+}
+
+// TestStdoutIsCSV checks that with -stdout, the -top report does not end up in the CSV.
+func TestStdoutIsCSV(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-quiet", "-stdout", "-config", "Base", "-top", "2", "-bins", "2", filepath.Join("testdata", "small.log")}
+	if err := run(args, nil, &stdout, &stderr); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.Bytes())
+	}
+	if _, err := csv.NewReader(bytes.NewReader(stdout.Bytes())).ReadAll(); err != nil {
+		t.Errorf("-stdout output with -top is not CSV: %v\n%s", err, stdout.Bytes())
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("Base: 1: ")) {
+		t.Errorf("-top report is not on standard error:\nstdout:\n%s\nstderr:\n%s", stdout.Bytes(), stderr.Bytes())
+	}
+}
+
+func TestReportDiffNotFinite(t *testing.T) {
+	d := &phasetimes.Diff{Phases: []phasetimes.PhaseDiff{{Phase: 0, A: 100, B: 150}, {Phase: 1, A: 0, B: 40}, {Phase: 2}}}
+	var b bytes.Buffer
+	reportDiff(&b, "Base", "Test", []string{"opt", "newphase", "gone"}, d, "ns")
+	out := b.String()
+	for _, want := range []string{"opt: Test/Base 1.500, delta +50ns", "newphase: new in Test, delta +40ns", "gone: absent from both"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Inf") || strings.Contains(out, "NaN") {
+		t.Errorf("report has a non-finite ratio:\n%s", out)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/dr2chase/gc-phase-times
+
+go 1.16
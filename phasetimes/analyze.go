@@ -0,0 +1,207 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"math"
+	"sort"
+)
+
+// A HotPhase is a phase whose cost, relative to the normalizer, grows with compilation size.
+type HotPhase struct {
+	Phase    int     // phase number
+	First    float64 // ratio in the first nonempty bin
+	Last     float64 // ratio in the last nonempty bin
+	Growth   float64 // Last / First
+	Slope    float64 // least-squares slope of the ratio against bin rank
+	Monotone bool    // the ratio never decreases from one bin to the next
+}
+
+// HotPhases fits each phase's per-bin ratio (as written by WriteCSV) against bin rank, and
+// returns the phases whose ratio rises monotonically, or whose last-bin ratio is at least
+// factor times its first-bin ratio, in order of decreasing growth.
+// Bins with a zero Norm are skipped.
+func HotPhases(bins []*PhaseSet, nphases int, factor float64) []HotPhase {
+	var hot []HotPhase
+	for i := 0; i < nphases; i++ {
+		var ratios []float64
+		for _, b := range bins {
+			if b == nil || b.Norm == 0 {
+				continue
+			}
+			ratios = append(ratios, float64(b.phase(i))/float64(b.Norm))
+		}
+		if len(ratios) < 2 {
+			continue
+		}
+		h := HotPhase{Phase: i, First: ratios[0], Last: ratios[len(ratios)-1], Monotone: true}
+		h.Growth = h.Last / h.First
+		for k := 1; k < len(ratios); k++ {
+			if ratios[k] < ratios[k-1] {
+				h.Monotone = false
+			}
+		}
+		h.Slope = slope(ratios)
+		if (h.Monotone && h.Last > h.First) || h.Growth >= factor {
+			hot = append(hot, h)
+		}
+	}
+	sort.SliceStable(hot, func(i, j int) bool {
+		return hot[i].Growth > hot[j].Growth
+	})
+	return hot
+}
+
+// slope returns the least-squares slope of y[k] against k.
+func slope(y []float64) float64 {
+	n := float64(len(y))
+	var sx, sy, sxx, sxy float64
+	for k, v := range y {
+		x := float64(k)
+		sx += x
+		sy += v
+		sxx += x * x
+		sxy += x * v
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return math.NaN()
+	}
+	return (n*sxy - sx*sy) / d
+}
+
+// A PhaseDiff compares the time spent in one phase by two configurations,
+// summed over the compilations that both configurations performed.
+type PhaseDiff struct {
+	Phase int    // phase number
+	A, B  uint64 // summed time in ns, for each configuration
+}
+
+// Ratio returns B/A, which is not finite if A is zero.
+func (d PhaseDiff) Ratio() float64 {
+	return float64(d.B) / float64(d.A)
+}
+
+// Delta returns B-A, in ns.
+func (d PhaseDiff) Delta() int64 {
+	return int64(d.B) - int64(d.A)
+}
+
+// A Diff compares the compilations of two configurations.
+type Diff struct {
+	Phases []PhaseDiff   // by decreasing absolute Delta
+	Common int           // number of compilations in both configurations
+	OnlyA  []Compilation // compilations only in the first configuration, sorted
+	OnlyB  []Compilation // compilations only in the second configuration, sorted
+}
+
+// Diff matches the compilations of configurations a and b and compares their phase times.
+func (r *Result) Diff(a, b string) *Diff {
+	ma, mb := r.configs[a], r.configs[b]
+	d := &Diff{Phases: make([]PhaseDiff, r.NumPhases())}
+	for i := range d.Phases {
+		d.Phases[i].Phase = i
+	}
+	for c, pa := range ma {
+		pb, ok := mb[c]
+		if !ok {
+			d.OnlyA = append(d.OnlyA, c)
+			continue
+		}
+		d.Common++
+		for i := range d.Phases {
+			d.Phases[i].A += uint64(pa.phase(i))
+			d.Phases[i].B += uint64(pb.phase(i))
+		}
+	}
+	for c := range mb {
+		if _, ok := ma[c]; !ok {
+			d.OnlyB = append(d.OnlyB, c)
+		}
+	}
+	sort.Slice(d.OnlyA, func(i, j int) bool { return d.OnlyA[i].less(d.OnlyA[j]) })
+	sort.Slice(d.OnlyB, func(i, j int) bool { return d.OnlyB[i].less(d.OnlyB[j]) })
+	sort.SliceStable(d.Phases, func(i, j int) bool {
+		return abs(d.Phases[i].Delta()) > abs(d.Phases[j].Delta())
+	})
+	return d
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Align matches the compilations of configs, returning, for each compilation performed by
+// every one of them, its phase times in each configuration, in the order of configs.
+// The compilations are sorted by name.  unmatched[k] is the number of compilations of
+// configs[k] that some other configuration did not perform.
+func (r *Result) Align(configs []string) (aligned [][]*PhaseSet, unmatched []int) {
+	unmatched = make([]int, len(configs))
+	if len(configs) == 0 {
+		return nil, unmatched
+	}
+	for c := range r.configs[configs[0]] {
+		row := make([]*PhaseSet, len(configs))
+		for k, cfg := range configs {
+			if row[k] = r.configs[cfg][c]; row[k] == nil {
+				row = nil
+				break
+			}
+		}
+		if row != nil {
+			aligned = append(aligned, row)
+		}
+	}
+	for k, cfg := range configs {
+		unmatched[k] = len(r.configs[cfg]) - len(aligned)
+	}
+	sort.Slice(aligned, func(i, j int) bool {
+		return aligned[i][0].Compilation.less(aligned[j][0].Compilation)
+	})
+	return aligned, unmatched
+}
+
+// A MissingPhase is a phase with times in some configurations but not others, as when a
+// compiler pass is renamed or removed between toolchain versions.
+type MissingPhase struct {
+	Phase   int      // phase number
+	Missing []string // the configurations with no time for the phase
+}
+
+// MissingPhases returns the phases with a recorded time in at least one of configs but not
+// in all of them, in phase number order.
+func (r *Result) MissingPhases(configs []string) []MissingPhase {
+	n := r.NumPhases()
+	seen := make([][]bool, len(configs))
+	count := make([]int, n)
+	for k, cfg := range configs {
+		seen[k] = make([]bool, n)
+		for _, ps := range r.configs[cfg] {
+			for i, t := range ps.Phases {
+				if (t != 0 || ps.zero(i)) && !seen[k][i] {
+					seen[k][i] = true
+					count[i]++
+				}
+			}
+		}
+	}
+	var missing []MissingPhase
+	for i := 0; i < n; i++ {
+		if count[i] == 0 || count[i] == len(configs) {
+			continue
+		}
+		m := MissingPhase{Phase: i}
+		for k, cfg := range configs {
+			if !seen[k][i] {
+				m.Missing = append(m.Missing, cfg)
+			}
+		}
+		missing = append(missing, m)
+	}
+	return missing
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var (
+	benchConfigs      = flag.Int("bench.configs", 0, "if positive, the configurations of BenchmarkPipeline's own size")
+	benchCompilations = flag.Int("bench.compilations", 1000, "compilations per configuration, with -bench.configs")
+	benchPhases       = flag.Int("bench.phases", 50, "phases per compilation, with -bench.configs")
+)
+
+// syntheticLog returns a log of configs configurations, each compiling the same compilations
+// functions with phases phases each, with times that vary by configuration, function, and phase.
+func syntheticLog(configs, compilations, phases int) []byte {
+	var b bytes.Buffer
+	for c := 0; c < configs; c++ {
+		fmt.Fprintf(&b, "(cd /home/u/gopath/src/x; GOPATH=/home/u/gopath GOROOT=/home/u/goroots/cfg%d/ go build -gcflags=all=-d=ssa/all/time=1 . )\n", c)
+		for f := 0; f < compilations; f++ {
+			if f%100 == 0 {
+				fmt.Fprintf(&b, "# example.com/pkg%d\n", f/100)
+			}
+			for p := 0; p < phases; p++ {
+				t := 1000 + (f*f%9973)*(p+1) + c*37
+				fmt.Fprintf(&b, "../../pkg%d/f%d.go:%d:6:\tphase %d\tTIME(ns)\t%d\tF%d\n", f/100, f, f%50+1, p, t, f)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// BenchmarkPipeline parses a synthetic log, bins each configuration, and writes its CSV to
+// io.Discard, as the command does.  Run with -benchmem for allocs/op, and with -bench.configs
+// and the other -bench flags for a size of one's own.
+func BenchmarkPipeline(b *testing.B) {
+	sizes := [][3]int{{1, 100, 10}, {2, 1000, 50}, {4, 5000, 50}}
+	if *benchConfigs > 0 {
+		sizes = [][3]int{{*benchConfigs, *benchCompilations, *benchPhases}}
+	}
+	for _, size := range sizes {
+		log := syntheticLog(size[0], size[1], size[2])
+		b.Run(fmt.Sprintf("configs=%d/compilations=%d/phases=%d", size[0], size[1], size[2]), func(b *testing.B) {
+			b.SetBytes(int64(len(log)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p := NewParser(Options{})
+				if err := p.Parse(context.Background(), "synthetic", bytes.NewReader(log)); err != nil {
+					b.Fatal(err)
+				}
+				r := p.Result()
+				for _, cfg := range r.Configs() {
+					prof, err := r.Binned(cfg, BinOptions{Bins: 50})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if err := WriteCSV(io.Discard, cfg, prof.Phases, prof.Bins, prof.Ranges, CSVOptions{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A Stat selects the per-compilation statistic whose bin total normalizes the bin's phase times.
+type Stat int
+
+const (
+	StatMedian      Stat = iota // median phase time
+	StatMean                    // mean phase time
+	StatP90                     // 90th percentile phase time
+	StatP99                     // 99th percentile phase time
+	StatGeomean                 // geometric mean of the total times; see sumBin
+	StatTotalMedian             // total time; see sumBin
+)
+
+var statNames = []string{"median", "mean", "p90", "p99", "geomean", "totalmedian"}
+
+func (s Stat) String() string {
+	return statNames[s]
+}
+
+// ParseStat returns the Stat named s.
+func ParseStat(s string) (Stat, error) {
+	for i, n := range statNames {
+		if s == n {
+			return Stat(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown statistic %q, expected one of %v", s, statNames)
+}
+
+// describe returns a description of the normalizer of a bin's phase times, for titles.
+func (s Stat) describe() string {
+	switch s {
+	case StatGeomean:
+		return "geometric mean of the bin's per-compilation total times"
+	case StatTotalMedian:
+		// Small compilations often have a median phase time of zero, but never a zero total.
+		return "(count * median per-compilation total time), the phase's share of a typical compilation in the bin"
+	}
+	return "bin total of per-compilation " + s.String() + " phase times"
+}
+
+// value returns statistic s of a single compilation's phase times.
+func (s Stat) value(aph *PhaseSet) uint64 {
+	switch s {
+	case StatMean:
+		return aph.MeanTime()
+	case StatP90:
+		return aph.PercentileTime(90)
+	case StatP99:
+		return aph.PercentileTime(99)
+	case StatTotalMedian:
+		return aph.Total
+	}
+	return aph.Median
+}
+
+// Samples returns the compilations of config, with their medians computed, sorted by
+// increasing total time, or by increasing time in phase number sortBy if that is not negative.
+// Compilations with fewer than requirePhases nonzero phase times are left out as incomplete,
+// and their number is returned as well.
+func (r *Result) Samples(config string, requirePhases, sortBy int) (samples []*PhaseSet, incomplete int) {
+	m := r.configs[config]
+	samples = make([]*PhaseSet, 0, len(m))
+	for _, allphs := range m {
+		if allphs.NonZeroPhases() < requirePhases {
+			incomplete++
+			continue
+		}
+		allphs.ComputeMedianTime()
+		samples = append(samples, allphs)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		si, sj := samples[i], samples[j]
+		if sortBy >= 0 {
+			if pi, pj := si.phase(sortBy), sj.phase(sortBy); pi != pj {
+				return pi < pj
+			}
+		}
+		if si.Total != sj.Total {
+			return si.Total < sj.Total
+		}
+		if si.Median != sj.Median {
+			return si.Median < sj.Median
+		}
+		// Break remaining ties by name so that bin membership is reproducible.
+		return si.Compilation.less(sj.Compilation)
+	})
+	return samples, incomplete
+}
+
+// ByPackage returns the phase times of the compilations in samples summed by package,
+// one PhaseSet per package with only Compilation.Pkg set, in order of decreasing total time.
+func (r *Result) ByPackage(samples []*PhaseSet) []*PhaseSet {
+	byPkg := make(map[string]*PhaseSet)
+	var pkgs []*PhaseSet
+	for _, sample := range samples {
+		p := byPkg[sample.Compilation.Pkg]
+		if p == nil {
+			p = r.newPhaseSet()
+			p.Compilation.Pkg = sample.Compilation.Pkg
+			byPkg[p.Compilation.Pkg] = p
+			pkgs = append(pkgs, p)
+		}
+		p.Total += sample.Total
+		for j, t := range sample.Phases {
+			p.Phases[j] += t
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Total != pkgs[j].Total {
+			return pkgs[i].Total > pkgs[j].Total
+		}
+		return pkgs[i].Compilation.Pkg < pkgs[j].Compilation.Pkg
+	})
+	return pkgs
+}
+
+// Bin splits samples, which should be sorted, into BINS bins of about the same number of compilations,
+// summing the phase times of the compilations in each bin.  Each bin's Norm is set according to stat;
+// for StatTotalMedian it is the number of compilations times the median of their totals, for
+// StatGeomean it is the geometric mean of their totals, otherwise it is the sum of the statistic,
+// such as the median phase time, over the bin's compilations.
+// ranges[i] holds the [start, end) indices in samples of the compilations in bins[i].
+func (r *Result) Bin(samples []*PhaseSet, BINS int, stat Stat) (bins []*PhaseSet, ranges [][2]int) {
+	bins = make([]*PhaseSet, BINS, BINS)
+	ranges = make([][2]int, BINS, BINS)
+	for binI := range bins {
+		// Integer bounds partition samples exactly; fractional bin sizes
+		// could overlap bins, drop the last samples, or overrun bins.
+		start, end := binI*len(samples)/BINS, (binI+1)*len(samples)/BINS
+		ranges[binI] = [2]int{start, end}
+		bins[binI] = r.sumBin(samples[start:end], stat)
+	}
+	return bins, ranges
+}
+
+// A BinMode says how compilations are assigned to bins.
+type BinMode int
+
+const (
+	BinCount   BinMode = iota // about the same number of compilations in each bin
+	BinLogTime                // bins of equal width in the logarithm of total time
+	BinLinTime                // bins of equal width in total time
+)
+
+var binModeNames = []string{"count", "logtime", "lintime"}
+
+func (m BinMode) String() string {
+	return binModeNames[m]
+}
+
+// ParseBinMode returns the BinMode named s.
+func ParseBinMode(s string) (BinMode, error) {
+	for i, n := range binModeNames {
+		if s == n {
+			return BinMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown bin mode %q, expected one of %v", s, binModeNames)
+}
+
+// BinByTotal is like Bin, but assigns each compilation to a bin by its total time, with the
+// bin edges evenly spaced between the smallest and largest totals, linearly or (for BinLogTime)
+// logarithmically.  samples must be sorted by total time.  Bins with no compilations are nil.
+// For BinCount, BinByTotal is the same as Bin.
+func (r *Result) BinByTotal(samples []*PhaseSet, BINS int, stat Stat, mode BinMode) (bins []*PhaseSet, ranges [][2]int) {
+	if mode == BinCount || len(samples) == 0 {
+		return r.Bin(samples, BINS, stat)
+	}
+	scale := func(t uint64) float64 {
+		if mode == BinLogTime {
+			return math.Log(math.Max(1, float64(t)))
+		}
+		return float64(t)
+	}
+	lo, hi := scale(samples[0].Total), scale(samples[len(samples)-1].Total)
+
+	bins = make([]*PhaseSet, BINS, BINS)
+	ranges = make([][2]int, BINS, BINS)
+	start := 0
+	for binI := 0; binI < BINS; binI++ {
+		end := start
+		for end < len(samples) {
+			k := BINS - 1
+			if hi > lo {
+				k = int(float64(BINS) * (scale(samples[end].Total) - lo) / (hi - lo))
+			}
+			if k > BINS-1 {
+				k = BINS - 1
+			}
+			if k > binI {
+				break
+			}
+			end++
+		}
+		ranges[binI] = [2]int{start, end}
+		if end > start {
+			bins[binI] = r.sumBin(samples[start:end], stat)
+		}
+		start = end
+	}
+	return bins, ranges
+}
+
+// BinByEdges is like Bin, but assigns each compilation to a bin by its total time, given
+// increasing bin edges in ns.  The bins are [0,edges[0]), [edges[0],edges[1]), ..., with a
+// final overflow bin for totals at or above the last edge.  samples must be sorted by total
+// time.  Bins with no compilations are nil.
+func (r *Result) BinByEdges(samples []*PhaseSet, edges []uint64, stat Stat) (bins []*PhaseSet, ranges [][2]int) {
+	bins = make([]*PhaseSet, len(edges)+1)
+	ranges = make([][2]int, len(edges)+1)
+	start := 0
+	for binI := range bins {
+		end := start
+		for end < len(samples) && (binI == len(edges) || samples[end].Total < edges[binI]) {
+			end++
+		}
+		ranges[binI] = [2]int{start, end}
+		if end > start {
+			bins[binI] = r.sumBin(samples[start:end], stat)
+		}
+		start = end
+	}
+	return bins, ranges
+}
+
+// sumBin returns the bin of the compilations in samples, as described for Bin.
+func (r *Result) sumBin(samples []*PhaseSet, stat Stat) *PhaseSet {
+	bin := r.newPhaseSet()
+	sumSq := make([]float64, len(bin.Phases))
+	bin.Culprits = make([]*PhaseSet, len(bin.Phases))
+	bin.Min = make([]PhaseTime, len(bin.Phases))
+	bin.Max = make([]PhaseTime, len(bin.Phases))
+	for i, sample := range samples {
+		if i == 0 || sample.Total < bin.MinTotal {
+			bin.MinTotal = sample.Total
+		}
+		if sample.Total > bin.MaxTotal {
+			bin.MaxTotal = sample.Total
+		}
+		bin.Norm += stat.value(sample)
+		bin.Total += sample.Total
+		for j := range bin.Phases {
+			t := sample.phase(j)
+			if i == 0 || t < bin.Min[j] {
+				bin.Min[j] = t
+			}
+			if t > bin.Max[j] {
+				bin.Max[j] = t
+			}
+			bin.Phases[j] += t
+			sumSq[j] += float64(t) * float64(t)
+			if t > 0 && (bin.Culprits[j] == nil || t > bin.Culprits[j].Phases[j]) {
+				bin.Culprits[j] = sample
+			}
+		}
+	}
+	if n := float64(len(samples)); n > 0 {
+		bin.StdDev = make([]float64, len(bin.Phases))
+		for j, t := range bin.Phases {
+			mean := float64(t) / n
+			bin.StdDev[j] = math.Sqrt(math.Max(0, sumSq[j]/n-mean*mean))
+		}
+	}
+	bin.ComputeMedianTime() // Something very flaky -- there are many w/ median == 0
+	switch stat {
+	case StatTotalMedian:
+		totals := make([]uint64, len(samples))
+		for i, sample := range samples {
+			totals[i] = sample.Total
+		}
+		sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+		if l := len(totals); l > 0 {
+			bin.Norm = uint64(l) * ((totals[l/2] + totals[(l-1)/2]) / 2)
+		}
+	case StatGeomean:
+		// In log space, to avoid overflow; a zero total (every phase below Options.Floor)
+		// is skipped, since its log is undefined.
+		bin.Norm = 0
+		sum, n := 0.0, 0
+		for _, sample := range samples {
+			if sample.Total > 0 {
+				sum += math.Log(float64(sample.Total))
+				n++
+			}
+		}
+		if n > 0 {
+			bin.Norm = uint64(math.Exp(sum / float64(n)))
+		}
+	}
+	return bin
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import "testing"
+
+func TestRequirePhases(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	100	Full
+../../a/a.go:3:6:	regalloc	TIME(ns)	200	Full
+../../a/a.go:3:6:	genssa	TIME(ns)	300	Full
+../../a/a.go:9:6:	opt	TIME(ns)	5000	Partial
+`
+	r := parseLog(t, Options{}, log)
+	samples, incomplete := r.Samples("Base", 2, -1)
+	if incomplete != 1 {
+		t.Errorf("%d compilations excluded as incomplete, want 1", incomplete)
+	}
+	if len(samples) != 1 || samples[0].Compilation.Func != "Full" {
+		t.Errorf("samples are %v, want only Full", samples)
+	}
+}
+
+func TestAllZeroCompilation(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	0	Zero
+../../a/a.go:3:6:	regalloc	TIME(ns)	0	Zero
+../../a/a.go:9:6:	opt	TIME(ns)	100	F
+`
+	for _, includeZero := range []bool{false, true} {
+		r := parseLog(t, Options{IncludeZero: includeZero}, log)
+		ps := r.Compilations("Base")[Compilation{Pkg: "example.com/a", Path: "GOPATH/a/a.go:3:6:", Func: "Zero"}]
+		if ps == nil {
+			t.Fatalf("IncludeZero=%v: no compilation for Zero", includeZero)
+		}
+		if m := ps.MedianTime(); m != 0 {
+			t.Errorf("IncludeZero=%v: median is %d, want 0", includeZero, m)
+		}
+		if _, err := r.Binned("Base", BinOptions{Bins: 2}); err != nil {
+			t.Errorf("IncludeZero=%v: %v", includeZero, err)
+		}
+	}
+}
+
+func TestGeomeanNorm(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	100	F
+../../a/a.go:3:6:	regalloc	TIME(ns)	100	F
+../../a/a.go:9:6:	opt	TIME(ns)	400	G
+../../a/a.go:9:6:	regalloc	TIME(ns)	400	G
+`
+	r := parseLog(t, Options{}, log)
+	prof, err := r.Binned("Base", BinOptions{Bins: 1, Stat: StatGeomean})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The totals are 200 and 800, whose geometric mean is 400.
+	if b := prof.Bins[0]; b.Norm < 399 || b.Norm > 400 {
+		t.Errorf("norm is %d, want 400", b.Norm)
+	}
+}
+
+func TestBinsCoverSamples(t *testing.T) {
+	r := parseLog(t, Options{}, string(syntheticLog(1, 97, 5)))
+	samples, _ := r.Samples("cfg0", 0, -1)
+	var want uint64
+	for _, s := range samples {
+		want += s.Total
+	}
+	for _, n := range []int{1, 3, 7, 10, 50, 97} {
+		bins, ranges := r.Bin(samples, n, StatMedian)
+		var got uint64
+		next := 0
+		for i, b := range bins {
+			if ranges[i][0] != next {
+				t.Errorf("%d bins: bin %d starts at %d, want %d", n, i, ranges[i][0], next)
+			}
+			next = ranges[i][1]
+			got += b.Total
+		}
+		if next != len(samples) {
+			t.Errorf("%d bins: bins end at %d, want %d", n, next, len(samples))
+		}
+		if got != want {
+			t.Errorf("%d bins: bin totals sum to %d, want %d, the total of all samples", n, got, want)
+		}
+	}
+}
+
+func TestMedianNorm(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	100	F
+../../a/a.go:3:6:	cse	TIME(ns)	900	F
+../../a/a.go:3:6:	regalloc	TIME(ns)	200	F
+../../a/a.go:9:6:	opt	TIME(ns)	1000	G
+../../a/a.go:9:6:	cse	TIME(ns)	3000	G
+../../a/a.go:9:6:	regalloc	TIME(ns)	5000	G
+`
+	r := parseLog(t, Options{}, log)
+	prof, err := r.Binned("Base", BinOptions{Bins: 1, Stat: StatMedian})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The medians are 200 and 3000; the median of the bin's phase totals would be 3900.
+	if b := prof.Bins[0]; b.Norm != 3200 {
+		t.Errorf("norm is %d, want 3200", b.Norm)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+// OtherCategory is the category of phases not otherwise categorized.
+const OtherCategory = "other"
+
+// phaseCategories assigns the SSA passes of cmd/compile to the part of the back end they belong to.
+// The front end (parse, typecheck) is not timed by -d=ssa/all/time=1, so it has no category.
+var phaseCategories = map[string][]string{
+	"ssa-build": {
+		"number lines", "early phielim", "early copyelim", "early deadcode", "short circuit",
+		"decompose user", "decompose args", "expand calls", "decompose builtin", "softfloat",
+		"pre-opt deadcode",
+	},
+	"ssa-opt": {
+		"opt", "zero arg cse", "opt deadcode", "generic cse", "phiopt", "gcse deadcode",
+		"nilcheckelim", "prove", "early fuse", "fuse plain", "late opt", "dead auto elim",
+		"sccp", "generic deadcode", "check bce", "branchelim", "late fuse", "dse", "memcombine",
+		"writebarrier", "insert resched checks", "loopbce", "invariant", "tighten tuple selectors",
+	},
+	"lower": {
+		"lower", "addressing modes", "late lower", "lowered deadcode for cse", "lowered cse",
+		"elim unread autos", "lowered deadcode", "checkLower", "late phielim", "late copyelim",
+		"tighten", "late deadcode", "critical", "phi tighten", "likelyadjust", "layout",
+		"schedule", "late nilcheck", "flagalloc",
+	},
+	"regalloc": {
+		"regalloc", "loop rotate", "stackalloc",
+	},
+	"codegen": {
+		"trim", "stackframe", "genssa",
+	},
+}
+
+// DefaultPhaseCategories returns a new map from the names of the compiler's phases to
+// their categories: ssa-build, ssa-opt, lower, regalloc, or codegen.
+func DefaultPhaseCategories() map[string]string {
+	m := make(map[string]string)
+	for cat, phases := range phaseCategories {
+		for _, p := range phases {
+			m[p] = cat
+		}
+	}
+	return m
+}
+
+// GroupPhases returns a new Result in which the phases of r are replaced by their categories,
+// with each compilation's time in a category the sum of its times in the category's phases.
+// Phases missing from categories are in OtherCategory.  Categories are in the order their
+// first phases appear in r.
+func (r *Result) GroupPhases(categories map[string]string) *Result {
+	g := newResult()
+	for c := range r.excludedConfigs {
+		g.excludedConfigs[c] = true
+	}
+	for c := range r.excludedPhases {
+		g.excludedPhases[c] = true
+	}
+	g.lines = r.lines
+	phases := r.Phases()
+	index := make([]int32, len(phases))
+	for i, p := range phases {
+		cat, ok := categories[p]
+		if !ok {
+			cat = OtherCategory
+		}
+		index[i] = g.phaseIndex.Index(intern(cat))
+	}
+	for cfg, m := range r.configs {
+		gm := make(map[Compilation]*PhaseSet, len(m))
+		for c, ps := range m {
+			gps := g.newPhaseSet()
+			gps.Compilation = c
+			for i, t := range ps.Phases {
+				gps.Phases[index[i]] += t
+			}
+			for i := range ps.Phases {
+				if ps.zero(i) {
+					gps.setTime(index[i], 0, DupFirst, true) // unless the category has time
+				}
+			}
+			gps.Total = ps.Total
+			gm[c] = gps
+		}
+		g.configs[cfg] = gm
+	}
+	return g
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+)
+
+type htmlCell struct {
+	Text  string  // what is shown
+	Value float64 // what the column sorts by
+	Title string  // tooltip, if any
+	Shade float64 // 0 to 1, how strongly to color the cell
+}
+
+type htmlReport struct {
+	Title  string
+	Header []string
+	Rows   [][]htmlCell
+	Totals []htmlCell
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: right; }
+th { cursor: pointer; background: #eee; }
+td:first-child, th:first-child { text-align: left; }
+tfoot td { font-weight: bold; }
+</style>
+</head>
+<body>
+<h3>{{.Title}}</h3>
+<table id="profile">
+<thead><tr>{{range $i, $h := .Header}}<th onclick="sortBy({{$i}})">{{$h}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td data-v="{{.Value}}"{{if .Title}} title="{{.Title}}"{{end}} style="background-color: rgba(255, 64, 0, {{.Shade}})">{{.Text}}</td>{{end}}</tr>
+{{end}}</tbody>
+<tfoot><tr>{{range .Totals}}<td>{{.Text}}</td>{{end}}</tr></tfoot>
+</table>
+<script>
+var ascending = {};
+function sortBy(col) {
+	var tbody = document.querySelector("#profile tbody");
+	var rows = Array.prototype.slice.call(tbody.rows);
+	var up = ascending[col] = !ascending[col];
+	rows.sort(function(a, b) {
+		var x = parseFloat(a.cells[col].dataset.v), y = parseFloat(b.cells[col].dataset.v);
+		return up ? x - y : y - x;
+	});
+	rows.forEach(function(r) { tbody.appendChild(r); });
+}
+</script>
+</body>
+</html>
+`))
+
+// WriteHTML writes the binned profile for configuration cfg, as computed by Result.Bin, to w
+// as a self-contained HTML page.  The table has the same bins and phase ratios as WriteCSV,
+// with each ratio shaded by its size and the phase's absolute time as a tooltip; clicking a
+// column heading sorts by that column.  opts.Columns and opts.Unit are used.
+func WriteHTML(w io.Writer, cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, opts CSVOptions) error {
+	cols := opts.columns(len(phases))
+	rep := htmlReport{
+		Title:  fmt.Sprintf("%s: binned compilation phase timing profiles, bin total of phase times / %s", cfg, opts.Stat.describe()),
+		Header: []string{"bin", "count"},
+	}
+	for _, i := range cols {
+		rep.Header = append(rep.Header, phases[i])
+	}
+	rep.Header = append(rep.Header, "TOTAL ("+opts.unitLabel()+")")
+
+	maxRatio := 0.0
+	phaseTotals := make([]PhaseTime, len(phases))
+	for binI, b := range bins {
+		if b == nil {
+			continue
+		}
+		n := ranges[binI][1] - ranges[binI][0]
+		row := []htmlCell{
+			{Text: opts.binLabel(binI, ranges[binI]), Value: float64(binI)},
+			{Text: fmt.Sprintf("%d", n), Value: float64(n)},
+		}
+		for i := range phases {
+			phaseTotals[i] += b.Phases[i]
+		}
+		for _, i := range cols {
+			r := float64(b.Phases[i]) / float64(b.Norm)
+			text := fmt.Sprintf("%5.2f", r)
+			if math.IsNaN(r) || math.IsInf(r, 0) {
+				r, text = 0, ""
+			}
+			maxRatio = math.Max(maxRatio, r)
+			row = append(row, htmlCell{
+				Text:  text,
+				Value: r,
+				Title: opts.Unit.format(uint64(b.Phases[i])) + " " + opts.unitLabel(),
+				Shade: r, // scaled below
+			})
+		}
+		row = append(row, htmlCell{Text: opts.Unit.format(b.Total), Value: float64(b.Total)})
+		rep.Rows = append(rep.Rows, row)
+	}
+	for _, row := range rep.Rows {
+		for k := 2; k < len(row)-1; k++ {
+			if maxRatio > 0 {
+				row[k].Shade = math.Round(100*row[k].Shade/maxRatio) / 100
+			}
+		}
+	}
+
+	rep.Totals = []htmlCell{{Text: "PHASE TOTALS (" + opts.unitLabel() + ")"}, {}}
+	total := PhaseTime(0)
+	for i := range phases {
+		total += phaseTotals[i]
+	}
+	for _, i := range cols {
+		rep.Totals = append(rep.Totals, htmlCell{Text: opts.Unit.format(uint64(phaseTotals[i]))})
+	}
+	rep.Totals = append(rep.Totals, htmlCell{Text: opts.Unit.format(uint64(total))})
+
+	return htmlTemplate.Execute(w, &rep)
+}
@@ -0,0 +1,793 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options control how a Parser turns log lines into compilations.
+type Options struct {
+	MergeSamePath  bool              // key compilations by package and source file, ignoring the function
+	SquashPosition bool              // key compilations without the line and column of the function
+	Floor          uint64            // phase times below this are treated as zero
+	ExcludeConfig  *regexp.Regexp    // if not nil, configurations matching this are ignored
+	MaxLine        int               // longest input line that can be scanned; zero means 16MB
+	Dup            DupPolicy         // how repeated times for one phase of one compilation are merged
+	ExcludePhases  []string          // phases whose times are ignored, as if they were not in the log
+	Metric         Metric            // which of a phase's measurements is recorded as its "time"
+	Rewrites       []Rewrite         // applied in order to each compilation's normalized path
+	Marker         string            // if not empty, the substring that identifies compile command lines; see isCompileLine
+	IncludeArch    bool              // append the compile line's GOOS= and GOARCH=, if any, to its configuration
+	IncludeZero    bool              // record zero phase times, instead of treating them as absent
+	Renames        map[string]string // configuration names replaced, before ExcludeConfig is applied
+	MergeGenerics  bool              // key compilations without the [...] type arguments of the function
+	ResolveGOROOT  bool              // merge configurations whose GOROOTs are the same directory; see ConfigAliases
+	Limit          int               // if positive, the compilations of a configuration first seen after this many are ignored
+	Sample         int               // if positive, keep a uniform random sample of this many compilations per configuration, instead of Limit
+	Seed           uint64            // chooses the compilations kept by Sample
+
+	// Since and Until, if not zero, bound the time of the compile command lines whose phase times
+	// are kept, as given by the last line before each that matches Timestamp.  Compile command
+	// lines before any timestamp are kept.  Timestamp's first subexpression, or if it has none its
+	// whole match, is parsed by ParseTimestamp; if Timestamp is nil, DefaultTimestamp is used.
+	Since, Until time.Time
+	Timestamp    *regexp.Regexp
+
+	// Progress, if not nil, is called every few thousand lines with the name of the log
+	// being parsed and the number of its lines scanned so far.
+	Progress func(name string, lines int)
+
+	// Interim, if not nil, is called every InterimEvery while a log is parsed, even while
+	// waiting for input, as when reading a build's log while it runs.  It may use the Result,
+	// which is not changed until it returns.  An error ends the parse.
+	Interim      func() error
+	InterimEvery time.Duration
+}
+
+// A Rewrite is a regular expression substitution applied to compilation paths, after the
+// built-in GOPATH/ and GOROOT/ normalization, for example to collapse module cache versions.
+type Rewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string // as for regexp.Regexp.ReplaceAllString
+}
+
+// ParseRewrite returns the Rewrite for s, of the form "pattern=>replacement".
+func ParseRewrite(s string) (Rewrite, error) {
+	i := strings.Index(s, "=>")
+	if i < 0 {
+		return Rewrite{}, fmt.Errorf("rewrite %q is not of the form pattern=>replacement", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return Rewrite{}, fmt.Errorf("rewrite %q: %w", s, err)
+	}
+	return Rewrite{Pattern: re, Replacement: s[i+2:]}, nil
+}
+
+// A Metric selects which measurement of a phase is recorded.  Logs from
+// -d=ssa/all/time=1 give only times; logs that also measure memory give, for each
+// phase, the time and then byte and allocation counts, keyed "TIME(ns):BYTES:ALLOCS".
+type Metric int
+
+const (
+	MetricTime   Metric = iota // nanoseconds
+	MetricAllocs               // number of allocations
+	MetricBytes                // bytes allocated
+)
+
+var (
+	metricNames = []string{"time", "allocs", "bytes"}
+	metricKeys  = []string{"TIME(ns)", "ALLOCS", "BYTES"}
+)
+
+func (m Metric) String() string {
+	return metricNames[m]
+}
+
+// heading returns the heading of a column of single measurements of m, such as a culprit's.
+func (m Metric) heading() string {
+	if m == MetricTime {
+		return "time"
+	}
+	return "count"
+}
+
+// ParseMetric returns the Metric named s.
+func ParseMetric(s string) (Metric, error) {
+	for i, n := range metricNames {
+		if s == n {
+			return Metric(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown metric %q, expected one of %v", s, metricNames)
+}
+
+// A Result holds the phase timings scraped from one or more logs, by configuration.
+type Result struct {
+	phaseIndex      *stringIndex
+	configs         map[string]map[Compilation]*PhaseSet // config -> compilation -> phase times
+	excludedConfigs map[string]bool
+	excludedPhases  map[string]bool
+	lines           LineCounts
+	timestamps      int                  // lines matching Options.Timestamp, when Since or Until is set
+	unnormalized    map[Compilation]bool // paths whose ../ went above the working directory
+	roots           map[string]string    // for Options.ResolveGOROOT, resolved GOROOT -> configuration
+	aliases         map[string]string    // configuration -> the configuration with the same GOROOT
+}
+
+// LineCounts counts the log lines scanned into a Result, by how they were understood.
+type LineCounts struct {
+	Lines    int // all lines
+	Compile  int // compile command lines, naming a configuration
+	Package  int // "# <PACKAGE>" lines
+	Time     int // phase timing lines recorded
+	Excluded int // phase timing lines of excluded configurations or phases
+	Limited  int // phase timing lines of compilations ignored for Options.Limit or Sample
+	Blank    int // empty or all white space
+	Ignored  int // anything else
+}
+
+// LineCounts returns the counts of the lines scanned so far.
+func (r *Result) LineCounts() LineCounts {
+	return r.lines
+}
+
+func newResult() *Result {
+	return &Result{
+		phaseIndex:      newStringIndex(),
+		configs:         make(map[string]map[Compilation]*PhaseSet),
+		excludedConfigs: make(map[string]bool),
+		excludedPhases:  make(map[string]bool),
+		unnormalized:    make(map[Compilation]bool),
+		roots:           make(map[string]string),
+		aliases:         make(map[string]string),
+	}
+}
+
+// Configs returns the names of the configurations seen, sorted.
+func (r *Result) Configs() []string {
+	configs := make([]string, 0, len(r.configs))
+	for s := range r.configs {
+		configs = append(configs, s)
+	}
+	sort.Strings(configs)
+	return configs
+}
+
+// ExcludedConfigs returns the names of the configurations ignored because of
+// Options.ExcludeConfig, sorted.
+func (r *Result) ExcludedConfigs() []string {
+	configs := make([]string, 0, len(r.excludedConfigs))
+	for s := range r.excludedConfigs {
+		configs = append(configs, s)
+	}
+	sort.Strings(configs)
+	return configs
+}
+
+// ExcludedPhases returns the names of the phases that were seen and ignored because of
+// Options.ExcludePhases, sorted.
+func (r *Result) ExcludedPhases() []string {
+	phases := make([]string, 0, len(r.excludedPhases))
+	for s := range r.excludedPhases {
+		phases = append(phases, s)
+	}
+	sort.Strings(phases)
+	return phases
+}
+
+// lineSource returns a function that returns the lines scanned in turn, or false at the end.
+// With Interim, the lines are scanned by another goroutine, so that Interim is called on time,
+// and cancellation noticed, even while waiting for more input; stop ends the goroutine, waiting
+// for its current read to return so that the reader can be closed.  Otherwise Parse notices
+// cancellation every few thousand lines.
+func (p *Parser) lineSource(ctx context.Context, scanner *bufio.Scanner) (next func() (string, bool, error), stop func()) {
+	if p.Interim == nil || p.InterimEvery <= 0 {
+		return func() (string, bool, error) {
+			if scanner.Scan() {
+				return scanner.Text(), true, nil
+			}
+			return "", false, nil
+		}, func() {}
+	}
+	lines := make(chan string, 64)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer close(lines)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(p.InterimEvery)
+	next = func() (string, bool, error) {
+		for {
+			select {
+			case line, ok := <-lines:
+				return line, ok, nil
+			case <-ticker.C:
+				if err := p.Interim(); err != nil {
+					return "", false, err
+				}
+			case <-ctx.Done():
+				return "", false, ctx.Err()
+			}
+		}
+	}
+	return next, func() {
+		ticker.Stop()
+		close(done)
+		<-exited
+	}
+}
+
+// Timestamps returns the number of timestamps found, when parsing with Options.Since or Until.
+func (r *Result) Timestamps() int {
+	return r.timestamps
+}
+
+// ConfigAliases returns, for each configuration merged into another by Options.ResolveGOROOT,
+// the configuration it was merged into.
+func (r *Result) ConfigAliases() map[string]string {
+	return r.aliases
+}
+
+// sameRoot returns the configuration of the first GOROOT seen that is the same directory as
+// goroot, after following symbolic links, or cfg if there is none.  A GOROOT that cannot be
+// resolved, as for a log from another machine, is compared as logged.
+func (r *Result) sameRoot(goroot, cfg string) string {
+	resolved := goroot
+	if dir, err := filepath.EvalSymlinks(filepath.FromSlash(goroot)); err == nil {
+		resolved = filepath.ToSlash(dir)
+	}
+	first, ok := r.roots[resolved]
+	if !ok {
+		r.roots[resolved] = cfg
+		return cfg
+	}
+	if first != cfg {
+		r.aliases[cfg] = first
+	}
+	return first
+}
+
+// Unnormalized returns the number of compilations whose logged path had more ../ than the
+// compile command's working directory has elements, and so are kept by their logged path.
+func (r *Result) Unnormalized() int {
+	return len(r.unnormalized)
+}
+
+// Compilations returns the phase timings of each compilation in config.
+// The map belongs to r and should not be modified.
+func (r *Result) Compilations(config string) map[Compilation]*PhaseSet {
+	return r.configs[config]
+}
+
+// Phases returns the phase names, indexed by phase number.  Phases are numbered in the order
+// they first appear in the logs, so the same logs, parsed in the same order, always give the
+// same numbering, independent of map iteration order.
+func (r *Result) Phases() []string {
+	return r.phaseIndex.Strings()
+}
+
+// NumPhases returns the number of distinct phases seen.
+func (r *Result) NumPhases() int {
+	return int(r.phaseIndex.NextIndex())
+}
+
+// PhaseTotals returns, for each phase, the sum of its times over all compilations of all configurations.
+func (r *Result) PhaseTotals() []uint64 {
+	totals := make([]uint64, r.NumPhases())
+	for _, m := range r.configs {
+		for _, ps := range m {
+			for i, t := range ps.Phases {
+				totals[i] += uint64(t)
+			}
+		}
+	}
+	return totals
+}
+
+// Phase returns the name of phase number i.
+func (r *Result) Phase(i int) string {
+	return r.phaseIndex.String(int32(i))
+}
+
+func (r *Result) newPhaseSet() *PhaseSet {
+	// This next bit ensures that for almost all cases, the right number of phases is pre-allocated
+	return &PhaseSet{Phases: make([]PhaseTime, r.phaseIndex.NextIndex(), r.phaseIndex.NextIndex())}
+}
+
+// A Parser scrapes phase timings from one or more logs, accumulating them into a single Result.
+// A Parser must not be used by more than one goroutine at a time, but separate Parsers may
+// run concurrently.
+type Parser struct {
+	Options
+	r *Result
+
+	onCompilation func(config string, c Compilation, ps *PhaseSet) error // see StreamParse
+	samplers      map[string]*sampler                                    // for Options.Sample, by configuration
+}
+
+// NewParser returns a Parser with the given options and an empty Result.
+func NewParser(opts Options) *Parser {
+	return &Parser{Options: opts, r: newResult()}
+}
+
+// Result returns the timings accumulated so far.
+func (p *Parser) Result() *Result {
+	return p.r
+}
+
+// Parse reads a single log from r with default options.
+func Parse(r io.Reader) (*Result, error) {
+	p := NewParser(Options{})
+	if err := p.Parse(context.Background(), "input", r); err != nil {
+		return nil, err
+	}
+	return p.Result(), nil
+}
+
+// StreamParse reads a single log from r with default options, calling onCompilation with
+// each compilation's phase times, and its configuration, as soon as the compilation is
+// complete, instead of accumulating them all in a Result.  This keeps memory bounded by the
+// size of one package's compilations.  The configuration is passed because a Compilation
+// does not record it, and a log usually holds several configurations compiling the same
+// functions, whose times would otherwise be indistinguishable.
+//
+// A compilation is taken to be complete when the log moves on to another package (a "# <PACKAGE>"
+// line) or another configuration (a compile command line), or at the end of the log; the
+// compilations of a package are passed in the order they first appeared, with Median computed.
+// If a compilation's times resume after that, it is passed again, separately.
+// Parsing stops at the first error returned by onCompilation, which StreamParse returns.
+func StreamParse(r io.Reader, onCompilation func(config string, c Compilation, ps *PhaseSet) error) error {
+	p := NewParser(Options{})
+	p.onCompilation = onCompilation
+	return p.Parse(context.Background(), "input", r)
+}
+
+// Parse reads one log from r, adding its phase timings to p's Result.
+// Errors are reported with name, used for the log's file name, and the line number.
+// Parsing stops early with an error if ctx is done.
+func (p *Parser) Parse(ctx context.Context, name string, r io.Reader) error {
+	maxLine := p.MaxLine
+	if maxLine == 0 {
+		maxLine = 16 << 20
+	}
+	scanner := bufio.NewScanner(r)
+	initial := 1 << 20
+	if initial > maxLine {
+		initial = maxLine // Buffer allows tokens up to the larger of capacity and max.
+	}
+	scanner.Buffer(make([]byte, 0, initial), maxLine)
+
+	// Scanning state starts over for each log, so nothing carries over from the previous one.
+	cfg := "UNSET_CONFIG"
+	pkg := "UNSET_PACKAGE"
+	gopath := "UNSET_GOPATH"
+	goroot := "UNSET_GOROOT"
+	pwd := "UNSET_PWD"
+
+	var compilations map[Compilation]*PhaseSet
+	excluding := false
+	var stamp time.Time // of the last timestamp line, for Since and Until
+	window := !p.Since.IsZero() || !p.Until.IsZero()
+	stampRE := p.Timestamp
+	if stampRE == nil {
+		stampRE = DefaultTimestamp
+	}
+
+	// For StreamParse, the compilations not yet passed to onCompilation, in order.
+	var pending []*PhaseSet
+	flush := func() error {
+		for _, ps := range pending {
+			delete(compilations, ps.Compilation)
+			ps.ComputeMedianTime()
+			if err := p.onCompilation(cfg, ps.Compilation, ps); err != nil {
+				return err
+			}
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	// String processing to scrape phase times out of a benchmark log
+	lineno := 0
+	next, stop := p.lineSource(ctx, scanner)
+	defer stop()
+	for {
+		line, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		lineno++
+		p.r.lines.Lines++
+		if lineno%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if p.Progress != nil {
+				p.Progress(name, lineno)
+			}
+		}
+		if lineno == 1 {
+			// A log that has passed through an editor may begin with a UTF-8 byte order mark.
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		lineErr := func(err error) error {
+			return fmt.Errorf("%s:%d: %w", name, lineno, err)
+		}
+		if window {
+			if m := stampRE.FindStringSubmatch(line); m != nil {
+				if t, ok := ParseTimestamp(m[len(m)-1]); ok {
+					stamp = t
+					p.r.timestamps++
+				}
+			}
+		}
+		switch {
+		case strings.TrimSpace(line) == "": // blank line, ignore
+			p.r.lines.Blank++
+
+		case p.isCompileLine(line):
+			p.r.lines.Compile++
+			if err := flush(); err != nil {
+				return err
+			}
+			var err error
+			if pwd, err = extractPrefixed(line, "(cd "); err != nil {
+				return lineErr(err)
+			}
+			if gopath, err = extractPrefixed(line, "GOPATH="); err != nil {
+				return lineErr(err)
+			}
+			if goroot, err = extractPrefixed(line, "GOROOT="); err != nil {
+				return lineErr(err)
+			}
+			i := strings.LastIndex(goroot, "/")
+			if i < 0 && goroot != "" { // an empty goroot was GOROOT=/, trimmed
+				return lineErr(fmt.Errorf("GOROOT lacks trailing configuration: %s", goroot))
+			}
+			cfg = goroot[i+1:]
+			if cfg == "" {
+				// As for GOROOT=/ or GOROOT=/r//, which have no last element to name
+				// them; tell such configurations apart by their whole GOROOTs.
+				h := fnv.New32a()
+				io.WriteString(h, goroot)
+				cfg = fmt.Sprintf("config-%08x", h.Sum32())
+			}
+			if p.ResolveGOROOT {
+				cfg = p.r.sameRoot(goroot, cfg)
+			}
+			if p.IncludeArch {
+				// A missing setting means the host's, which the line does not say.
+				for _, prefix := range []string{"GOOS=", "GOARCH="} {
+					if v, err := extractPrefixed(line, prefix); err == nil && v != "" {
+						cfg += "-" + v
+					}
+				}
+			}
+			if r, ok := p.Renames[cfg]; ok {
+				cfg = r
+			}
+			cfg = intern(cfg)
+			excluding = p.ExcludeConfig != nil && p.ExcludeConfig.MatchString(cfg)
+			if excluding {
+				p.r.excludedConfigs[cfg] = true
+				compilations = nil
+				break
+			}
+			if !stamp.IsZero() && (!p.Since.IsZero() && stamp.Before(p.Since) || !p.Until.IsZero() && stamp.After(p.Until)) {
+				excluding = true // outside the time window
+				compilations = nil
+				break
+			}
+			var ok bool
+			compilations, ok = p.r.configs[cfg]
+			if !ok {
+				compilations = make(map[Compilation]*PhaseSet)
+				p.r.configs[cfg] = compilations
+			}
+
+		case strings.HasPrefix(line, "# "):
+			p.r.lines.Package++
+			if err := flush(); err != nil {
+				return err
+			}
+			pkg = intern(strings.TrimSpace(line[2:]))
+
+		case strings.Contains(line, "TIME(ns)") && !excluding:
+			if compilations == nil {
+				return lineErr(fmt.Errorf("phase timing before any compile command line"))
+			}
+			fields := strings.Split(line, "\t")
+			if len(fields) < 5 {
+				return lineErr(fmt.Errorf("expected 5 tab-separated fields in TIME(ns) line, saw %d", len(fields)))
+			}
+			for i, s := range fields {
+				fields[i] = strings.TrimSpace(s)
+			}
+			// fields[2] names the measurements that follow it, then comes the function.
+			keys := strings.Split(fields[2], ":")
+			if len(fields) < 4+len(keys) {
+				return lineErr(fmt.Errorf("expected %d tab-separated fields in %s line, saw %d", 4+len(keys), fields[2], len(fields)))
+			}
+			metric := -1
+			for i, k := range keys {
+				if k == metricKeys[p.Metric] {
+					metric = i
+				}
+			}
+			if metric < 0 {
+				return lineErr(fmt.Errorf("no %s measurement in %s line", metricKeys[p.Metric], fields[2]))
+			}
+			if p.excludePhase(fields[1]) {
+				p.r.excludedPhases[intern(fields[1])] = true
+				p.r.lines.Excluded++
+				break
+			}
+			// Logs captured on Windows use backslashes; normalize so that
+			// prefix matching and ../ removal below need only handle slashes.
+			pathLCcolon := toSlash(fields[0])
+			phase := p.r.phaseIndex.Index(intern(fields[1]))
+			timeField := fields[3+metric]
+			funcOrMethod := intern(fields[3+len(keys)])
+
+			// This nonsense is to shorten and normalize names across two different benchmark runs.
+			// That turned out not to be necessary, but perhaps in a future version of this fine
+			// piece of code it will make sense to match compilation to compilation across configurations.
+			unnormalized := false
+			if strings.HasPrefix(pathLCcolon, "../") {
+				pwdPrefix, rest := pwd, pathLCcolon
+				for strings.HasPrefix(rest, "../") {
+					rest = rest[3:]
+					i := strings.LastIndex(pwdPrefix, "/")
+					if i < 0 {
+						// The ../ went above the root; keep the path as logged.
+						unnormalized = true
+						break
+					}
+					pwdPrefix = pwdPrefix[:i]
+				}
+				if !unnormalized {
+					pathLCcolon = pwdPrefix + "/" + rest
+				}
+			}
+			// An empty GOPATH= or GOROOT= (or GOROOT=/) is no prefix at all.
+			if gopath != "" && strings.HasPrefix(pathLCcolon, gopath+"/") {
+				pathLCcolon = "GOPATH/" + pathLCcolon[len(gopath)+1:]
+			} else if goroot != "" && strings.HasPrefix(pathLCcolon, goroot+"/") {
+				pathLCcolon = "GOROOT/" + pathLCcolon[len(goroot)+1:]
+			}
+			for _, rw := range p.Rewrites {
+				pathLCcolon = rw.Pattern.ReplaceAllString(pathLCcolon, rw.Replacement)
+			}
+			if p.MergeSamePath || p.SquashPosition {
+				pathLCcolon = stripPosition(pathLCcolon)
+			}
+			if p.MergeSamePath {
+				funcOrMethod = ""
+			} else if p.MergeGenerics {
+				funcOrMethod = intern(stripTypeArgs(funcOrMethod))
+			}
+			pathLCcolon = intern(pathLCcolon)
+
+			c := Compilation{Pkg: pkg, Path: pathLCcolon, Func: funcOrMethod}
+			if pkg == commandLineArguments {
+				// Files named on the go command line are all built as this pseudo-package,
+				// whatever directory they are in; tell them apart by their directory.
+				c.Pkg = intern(pkg + " (" + path.Dir(stripPosition(pathLCcolon)) + ")")
+			}
+			t, err := strconv.ParseUint(timeField, 10, 64)
+			if err != nil {
+				return lineErr(fmt.Errorf("phase time was not an integer: %w", err))
+			}
+			allphs := compilations[c]
+			if allphs == nil && p.Sample > 0 {
+				keep, evict, evicted := p.sampler(cfg).admit(c, p.Seed, p.Sample)
+				if !keep {
+					p.r.lines.Limited++
+					break
+				}
+				if evicted {
+					delete(compilations, evict)
+					// Forget its unnormalized path too, unless another configuration has it.
+					elsewhere := false
+					for _, m := range p.r.configs {
+						if m[evict] != nil {
+							elsewhere = true
+							break
+						}
+					}
+					if !elsewhere {
+						delete(p.r.unnormalized, evict)
+					}
+				}
+			} else if allphs == nil && p.Limit > 0 && len(compilations) >= p.Limit {
+				// Only the compilations first seen are kept, so the sample favors whatever
+				// the build compiled early, such as the packages everything depends on.
+				p.r.lines.Limited++
+				break
+			}
+			p.r.lines.Time++
+			if unnormalized {
+				p.r.unnormalized[c] = true
+			}
+			if allphs == nil {
+				allphs = p.r.newPhaseSet()
+				allphs.Compilation = c
+				compilations[c] = allphs
+				if p.onCompilation != nil {
+					pending = append(pending, allphs)
+				}
+			}
+			if t >= p.Floor {
+				allphs.setTime(phase, t, p.Dup, p.IncludeZero)
+			}
+		default: // ignore
+			if excluding && strings.Contains(line, "TIME(ns)") {
+				p.r.lines.Excluded++
+			} else {
+				p.r.lines.Ignored++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("problem reading (scanning) %s: %w", name, err)
+	}
+	return flush()
+}
+
+// sampler returns the sampler of config's compilations, for Options.Sample.
+func (p *Parser) sampler(config string) *sampler {
+	if p.samplers == nil {
+		p.samplers = make(map[string]*sampler)
+	}
+	s := p.samplers[config]
+	if s == nil {
+		s = &sampler{}
+		p.samplers[config] = s
+	}
+	return s
+}
+
+// excludePhase reports whether the times of phase are to be ignored.
+func (p *Parser) excludePhase(phase string) bool {
+	for _, x := range p.ExcludePhases {
+		if phase == x {
+			return true
+		}
+	}
+	return false
+}
+
+// toSlash replaces the backslashes in a Windows path with slashes.
+func toSlash(path string) string {
+	return strings.ReplaceAll(path, `\`, "/")
+}
+
+// stripPosition removes the trailing ":<line>:<column>:" from a compilation's path,
+// leaving just the file name.
+func stripPosition(pathLCcolon string) string {
+	s := strings.TrimSuffix(pathLCcolon, ":")
+	for n := 0; n < 2; n++ {
+		i := strings.LastIndex(s, ":")
+		if i < 0 {
+			break
+		}
+		if _, err := strconv.Atoi(s[i+1:]); err != nil {
+			break
+		}
+		s = s[:i]
+	}
+	return s
+}
+
+// commandLineArguments is the package header of files named on the go command line.
+const commandLineArguments = "command-line-arguments"
+
+// DefaultTimestamp matches a date and time, such as 2006-01-02T15:04:05Z07:00 or
+// 2006-01-02 15:04:05, at the beginning of a line.
+var DefaultTimestamp = regexp.MustCompile(`^\[?(\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d)?)`)
+
+// timestampLayouts are the forms ParseTimestamp accepts.
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04:05Z07:00", "2006-01-02"}
+
+// ParseTimestamp parses s as a date and time in one of the forms of RFC 3339, with a T or
+// space between date and time, and an optional fraction and time zone (UTC if none), or as
+// just a date.  The bool result reports whether s was understood.
+func ParseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// stripTypeArgs removes the bracketed type arguments from the name of an instantiated generic
+// function or method, such as Map[go.shape.int,go.shape.string] or (*List[go.shape.int]).Push,
+// including those of the enclosing function of a closure.
+func stripTypeArgs(funcOrMethod string) string {
+	if !strings.Contains(funcOrMethod, "[") {
+		return funcOrMethod
+	}
+	var b strings.Builder
+	depth := 0
+	for _, r := range funcOrMethod {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// defaultMarkers identify compile command lines when Options.Marker is empty: the timing
+// flag applied to all packages, or (without all=) to only the packages named on the command line.
+var defaultMarkers = []string{
+	"gcflags=all=-d=ssa/all/time=1",
+	"gcflags=all=-d=ssa/all/time=2",
+	"gcflags=-d=ssa/all/time=1",
+	"gcflags=-d=ssa/all/time=2",
+}
+
+// isCompileLine reports whether line is a compile command line, which names the
+// configuration of the timings that follow it.
+func (p *Parser) isCompileLine(line string) bool {
+	if p.Marker != "" {
+		return strings.Contains(line, p.Marker)
+	}
+	for _, m := range defaultMarkers {
+		if strings.Contains(line, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractPrefixed ensures that line contains prefix, and returns the space-ended word
+// that immediately follows prefix, or the rest of the line if no space follows.
+// Backslashes are converted to slashes, a trailing parenthesis, semicolon and slash are
+// removed, and the result is de-duplicated (interned).
+func extractPrefixed(line, prefix string) (string, error) {
+	i := strings.Index(line, prefix)
+	if i < 0 {
+		return "", fmt.Errorf("compile line is missing %s prefixed string, line = %s", prefix, line)
+	}
+	goroot := line[i+len(prefix):]
+	if i = strings.Index(goroot, " "); i >= 0 {
+		goroot = goroot[:i]
+	}
+	goroot = toSlash(goroot)
+	goroot = strings.TrimSuffix(goroot, ")") // the value ended the (cd ...) subshell
+	goroot = strings.TrimSuffix(goroot, ";") // easy extension to cd case
+	goroot = strings.TrimSuffix(goroot, "/")
+	return intern(goroot), nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// compileLine is a compile command line for configuration cfg, for test logs.
+func compileLine(cfg string) string {
+	return "(cd /home/u/gopath/src/x; GOPATH=/home/u/gopath GOROOT=/home/u/goroots/" + cfg + "/ go build -gcflags=all=-d=ssa/all/time=1 . )\n"
+}
+
+// parseLog parses log with opts, failing the test on an error.
+func parseLog(t *testing.T, opts Options, log string) *Result {
+	t.Helper()
+	p := NewParser(opts)
+	if err := p.Parse(context.Background(), t.Name(), strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	return p.Result()
+}
+
+// only returns the single compilation of config in r, failing the test if there is not exactly one.
+func only(t *testing.T, r *Result, config string) (Compilation, *PhaseSet) {
+	t.Helper()
+	m := r.Compilations(config)
+	if len(m) != 1 {
+		t.Fatalf("%s: got %d compilations, want 1: %v", config, len(m), m)
+	}
+	for c, ps := range m {
+		return c, ps
+	}
+	panic("unreachable")
+}
+
+func TestBOM(t *testing.T) {
+	log, err := os.ReadFile("testdata/bom.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := parseLog(t, Options{}, string(log))
+	if got := r.Configs(); len(got) != 1 || got[0] != "Base" {
+		t.Fatalf("configurations are %q, want [Base]", got)
+	}
+	c, ps := only(t, r, "Base")
+	if want := (Compilation{Pkg: "example.com/a", Path: "GOPATH/a/a.go:3:6:", Func: "F"}); c != want {
+		t.Errorf("compilation is %+v, want %+v", c, want)
+	}
+	if ps.Total != 300 {
+		t.Errorf("total is %d, want 300", ps.Total)
+	}
+	if lc := r.LineCounts(); lc.Compile != 1 || lc.Blank != 1 || lc.Time != 2 {
+		t.Errorf("line counts are %+v, want 1 compile command, 1 blank, and 2 phase times", lc)
+	}
+}
+
+func TestMergeSamePath(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	500	F[int]
+../../a/a.go:9:6:	opt	TIME(ns)	700	F[string]
+../../a/b.go:3:6:	opt	TIME(ns)	900	G
+`
+	r := parseLog(t, Options{MergeSamePath: true, Dup: DupSum}, log)
+	m := r.Compilations("Base")
+	if len(m) != 2 {
+		t.Fatalf("got %d compilations, want one per file: %v", len(m), m)
+	}
+	a := m[Compilation{Pkg: "example.com/a", Path: "GOPATH/a/a.go"}]
+	if a == nil {
+		t.Fatalf("no compilation for a.go: %v", m)
+	}
+	if a.Total != 1200 {
+		t.Errorf("a.go total is %d, want 1200, the sum of its functions' times", a.Total)
+	}
+}
+
+func TestSquashPosition(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	500	init
+../../a/a.go:9:6:	opt	TIME(ns)	700	init
+../../a/a.go:9:6:	regalloc	TIME(ns)	100	init
+`
+	r := parseLog(t, Options{SquashPosition: true, Dup: DupSum}, log)
+	c, ps := only(t, r, "Base")
+	if c.Path != "GOPATH/a/a.go" {
+		t.Errorf("path is %q, want it without the position", c.Path)
+	}
+	if ps.Total != 1300 {
+		t.Errorf("total is %d, want 1300, the times at both positions", ps.Total)
+	}
+}
+
+func TestFloor(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns)	5	F
+../../a/a.go:3:6:	cse	TIME(ns)	99	F
+../../a/a.go:3:6:	regalloc	TIME(ns)	100	F
+../../a/a.go:3:6:	genssa	TIME(ns)	250	F
+`
+	r := parseLog(t, Options{Floor: 100}, log)
+	_, ps := only(t, r, "Base")
+	if ps.Total != 350 {
+		t.Errorf("total is %d, want 350, only the times at or above the floor", ps.Total)
+	}
+	if n := ps.NonZeroPhases(); n != 2 {
+		t.Errorf("%d phases have times, want 2", n)
+	}
+}
+
+func TestExtractPrefixed(t *testing.T) {
+	tests := []struct {
+		line, prefix, want string
+	}{
+		{"GOROOT=/r/Base/ go build", "GOROOT=", "/r/Base"},
+		{"(cd /x; GOROOT=/r/Base)", "GOROOT=", "/r/Base"},
+		{"GOROOT=/r/Base", "GOROOT=", "/r/Base"}, // the value ends the line
+		{"(cd /home/u/x; go build)", "(cd ", "/home/u/x"},
+		{`GOROOT=C:\r\Base\ go build`, "GOROOT=", "C:/r/Base"},
+	}
+	for _, test := range tests {
+		got, err := extractPrefixed(test.line, test.prefix)
+		if err != nil || got != test.want {
+			t.Errorf("extractPrefixed(%q, %q) = %q, %v, want %q", test.line, test.prefix, got, err, test.want)
+		}
+	}
+	if _, err := extractPrefixed("go build", "GOROOT="); err == nil {
+		t.Errorf("extractPrefixed without the prefix did not fail")
+	}
+}
+
+// TestConcurrentParsers parses two logs at once, sharing the interned strings; run it with -race.
+func TestConcurrentParsers(t *testing.T) {
+	logs := [][]byte{syntheticLog(2, 200, 10), syntheticLog(3, 100, 20)}
+	results := make([]*Result, len(logs))
+	errs := make([]error, len(logs))
+	var wg sync.WaitGroup
+	for i := range logs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := NewParser(Options{})
+			errs[i] = p.Parse(context.Background(), "synthetic", bytes.NewReader(logs[i]))
+			results[i] = p.Result()
+		}(i)
+	}
+	wg.Wait()
+	for i, r := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		serial := parseLog(t, Options{}, string(logs[i]))
+		if got, want := len(r.Configs()), len(serial.Configs()); got != want {
+			t.Errorf("log %d: %d configurations, want %d", i, got, want)
+		}
+		if got, want := r.NumPhases(), serial.NumPhases(); got != want {
+			t.Errorf("log %d: %d phases, want %d", i, got, want)
+		}
+		for _, cfg := range serial.Configs() {
+			if got, want := len(r.Compilations(cfg)), len(serial.Compilations(cfg)); got != want {
+				t.Errorf("log %d: %s has %d compilations, want %d", i, cfg, got, want)
+			}
+		}
+	}
+}
+
+func TestEmptyConfigName(t *testing.T) {
+	line := func(goroot string) string {
+		return "(cd /home/u/gopath/src/x; GOPATH=/home/u/gopath GOROOT=" + goroot + " go build -gcflags=all=-d=ssa/all/time=1 . )\n" +
+			"# example.com/a\n../../a/a.go:3:6:\topt\tTIME(ns)\t100\tF\n"
+	}
+	r := parseLog(t, Options{}, line("/r1//")+line("/r2//")+line("/"))
+	configs := r.Configs()
+	if len(configs) != 3 {
+		t.Fatalf("configurations are %q, want one for each GOROOT", configs)
+	}
+	for _, c := range configs {
+		if !strings.HasPrefix(c, "config-") {
+			t.Errorf("configuration %q is not named by its GOROOT's hash", c)
+		}
+	}
+}
+
+func TestEmptyGOPATH(t *testing.T) {
+	log := "(cd /home/u/x; GOPATH= GOROOT=/home/u/goroots/Base/ go build -gcflags=all=-d=ssa/all/time=1 . )\n" + `# example.com/a
+/abc.go:3:6:	opt	TIME(ns)	100	F
+/home/u/goroots/Base/src/fmt/print.go:3:6:	opt	TIME(ns)	100	G
+/home/u/goroots/Base:	opt	TIME(ns)	100	H
+`
+	r := parseLog(t, Options{}, log)
+	paths := make(map[string]bool)
+	for c := range r.Compilations("Base") {
+		paths[c.Path] = true
+	}
+	for _, want := range []string{"/abc.go:3:6:", "GOROOT/src/fmt/print.go:3:6:", "/home/u/goroots/Base:"} {
+		if !paths[want] {
+			t.Errorf("no compilation with path %s: %v", want, paths)
+		}
+	}
+}
+
+func TestWindowsLog(t *testing.T) {
+	log := strings.ReplaceAll(`(cd C:\Users\u\gopath\src\x; GOPATH=C:\Users\u\gopath GOROOT=C:\Users\u\goroots\Base\ go build -gcflags=all=-d=ssa/all/time=1 . )
+# example.com/a
+..\..\a\a.go:3:6:	opt	TIME(ns)	100	F
+..\..\a\a.go:3:6:	regalloc	TIME(ns)	200	F
+C:\Users\u\goroots\Base\src\fmt\print.go:9:6:	opt	TIME(ns)	300	G
+`, "\n", "\r\n")
+	r := parseLog(t, Options{}, log)
+	if got := r.Configs(); len(got) != 1 || got[0] != "Base" {
+		t.Fatalf("configurations are %q, want [Base]", got)
+	}
+	m := r.Compilations("Base")
+	f := m[Compilation{Pkg: "example.com/a", Path: "GOPATH/a/a.go:3:6:", Func: "F"}]
+	if f == nil || f.Total != 300 {
+		t.Errorf("no compilation of F at GOPATH/a/a.go:3:6: with total 300: %v", m)
+	}
+	if m[Compilation{Pkg: "example.com/a", Path: "GOROOT/src/fmt/print.go:9:6:", Func: "G"}] == nil {
+		t.Errorf("no compilation of G at GOROOT/src/fmt/print.go:9:6:: %v", m)
+	}
+}
+
+func TestSampleEvictsUnnormalized(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(compileLine("Base") + "# example.com/a\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&b, "../../../../../../../a%d.go:3:6:\topt\tTIME(ns)\t100\tF\n", i)
+	}
+	r := parseLog(t, Options{Sample: 3}, b.String())
+	if n := len(r.Compilations("Base")); n != 3 {
+		t.Fatalf("%d compilations kept, want 3", n)
+	}
+	if n := r.Unnormalized(); n != 3 {
+		t.Errorf("%d unnormalized paths, want 3, those of the compilations kept", n)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package phasetimes scrapes per-phase compilation times out of a benchmark log
+// from gc's -d=ssa/all/time=1 debugging flag, and bins the compilations by total
+// time so that phases whose cost is non-linear in input size stand out.
+//
+// A log is scanned for lines of the form
+//
+//	(cd ... GOPATH=/Users/drchase/work/bent/gopath ... GOROOT=/Users/drchase/work/bent/goroots/<CONFIG>/ ... -gcflags=all=-d=ssa/all/time=1 . )
+//	# <PACKAGE>
+//	<PATH>:<line>:<column>:<tab><PHASE><tab>TIME(ns)<tab><TIME><tab><FUNC-OR-METHOD>
+//
+// and the phase timings are organized into tuples of
+//
+//	"config"       "compilation"                     "phase"   "time"
+//	<CONFIG>  : <NORMALIZED-PATH>,<FUNC-OR-METHOD> : <PHASE> : <TIME>
+package phasetimes
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// A Compilation identifies one function (or method) compiled in one package.
+type Compilation struct {
+	Pkg  string
+	Path string // normalized source path, including the trailing :<line>:<column>:
+	Func string
+}
+
+func (c Compilation) less(d Compilation) bool {
+	if c.Pkg != d.Pkg {
+		return c.Pkg < d.Pkg
+	}
+	if c.Path != d.Path {
+		return c.Path < d.Path
+	}
+	return c.Func < d.Func
+}
+
+// A PhaseSet holds the time spent in each phase of one compilation, or summed over a bin
+// of compilations.  Phases is indexed by phase number; see Result.Phases for the names.
+type PhaseSet struct {
+	Compilation   Compilation // zero for bins
+	Total, Median uint64
+	Norm          uint64 // for bins, what the phase times are divided by; see Stat
+	MinTotal      uint64 // for bins, the smallest Total of the compilations in the bin
+	MaxTotal      uint64 // for bins, the largest Total of the compilations in the bin
+	Phases        []PhaseTime
+	StdDev        []float64   // for bins, the standard deviation of each phase's per-compilation times
+	Culprits      []*PhaseSet // for bins, the compilation with the largest time in each phase
+	Min, Max      []PhaseTime // for bins, the smallest and largest per-compilation time in each phase
+
+	haveMedian bool   // Median is up to date, even if zero
+	zeros      []bool // phases recorded with a zero time; see Options.IncludeZero
+}
+
+// PhaseTime is the time spent in a phase, in nanoseconds.
+type PhaseTime uint64
+
+// A DupPolicy says how a second time for the same phase of a compilation is merged with
+// the time already recorded, as happens when a function is compiled more than once in a build.
+type DupPolicy int
+
+const (
+	DupFirst DupPolicy = iota // keep the first time
+	DupSum                    // add the times
+	DupLast                   // keep the last time
+	DupMax                    // keep the larger time
+)
+
+var dupNames = []string{"first", "sum", "last", "max"}
+
+func (d DupPolicy) String() string {
+	return dupNames[d]
+}
+
+// ParseDupPolicy returns the DupPolicy named s.
+func ParseDupPolicy(s string) (DupPolicy, error) {
+	for i, n := range dupNames {
+		if s == n {
+			return DupPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown duplicate policy %q, expected one of %v", s, dupNames)
+}
+
+// setTime records time for phase, merging it with any time already recorded according to dup.
+// A zero time is dropped unless includeZero is set, in which case the phase counts as recorded,
+// both for NonZeroPhases and for dup, but still adds nothing to Total.
+func (aph *PhaseSet) setTime(phase int32, time uint64, dup DupPolicy, includeZero bool) {
+	if time == 0 && !includeZero {
+		return
+	}
+	for len(aph.Phases) <= int(phase) {
+		aph.Phases = append(aph.Phases, 0)
+	}
+	old := aph.Phases[phase]
+	t := PhaseTime(time)
+	if old != 0 || aph.zero(int(phase)) {
+		switch dup {
+		case DupFirst:
+			return
+		case DupSum:
+			t += old
+		case DupMax:
+			if t < old {
+				return
+			}
+		}
+	}
+	aph.Phases[phase] = t
+	aph.Total = aph.Total - uint64(old) + uint64(t)
+	aph.haveMedian = false
+	if t == 0 {
+		for len(aph.zeros) <= int(phase) {
+			aph.zeros = append(aph.zeros, false)
+		}
+		aph.zeros[phase] = true
+	}
+}
+
+// zero reports whether phase i was recorded with a zero time.
+func (aph *PhaseSet) zero(i int) bool {
+	return i < len(aph.zeros) && aph.zeros[i]
+}
+
+// phase returns the time for phase i, which is zero if the phase was never recorded.
+func (aph *PhaseSet) phase(i int) PhaseTime {
+	if i >= len(aph.Phases) {
+		return 0
+	}
+	return aph.Phases[i]
+}
+
+// Share returns the fraction of aph's total time spent in phase i.
+func (aph *PhaseSet) Share(i int) float64 {
+	if aph.Total == 0 || i >= len(aph.Phases) {
+		return 0
+	}
+	return float64(aph.Phases[i]) / float64(aph.Total)
+}
+
+// NonZeroPhases returns the number of phases with a recorded time, which is nonzero
+// unless the log was parsed with Options.IncludeZero.
+func (aph *PhaseSet) NonZeroPhases() int {
+	n := 0
+	for i, t := range aph.Phases {
+		if t != 0 || aph.zero(i) {
+			n++
+		}
+	}
+	return n
+}
+
+// MedianTime returns the median phase time, computing it if necessary.
+func (aph *PhaseSet) MedianTime() uint64 {
+	if !aph.haveMedian {
+		aph.ComputeMedianTime()
+	}
+	return aph.Median
+}
+
+// ComputeMedianTime sets Median to the median of the phase times, or zero if there are none.
+// Phases with no recorded time count as zero, so recording zero times does not change it.
+func (aph *PhaseSet) ComputeMedianTime() {
+	aph.haveMedian = true
+	l := len(aph.Phases)
+	if l == 0 {
+		aph.Median = 0
+		return
+	}
+	scratch := make([]PhaseTime, 0, l)
+	scratch = append(scratch, aph.Phases...)
+	sort.Slice(scratch, func(i, j int) bool {
+		return scratch[i] < scratch[j]
+	})
+	// check median A={x,y} => (A[2/2]+A[(1/2)])/2
+	// check median A={x,y,z} => (A[3/2]+A[(2/2)])/2
+	aph.Median = uint64(scratch[l/2]+scratch[(l-1)/2]) / 2
+}
+
+// MeanTime returns the arithmetic mean of the phase times.
+func (aph *PhaseSet) MeanTime() uint64 {
+	if len(aph.Phases) == 0 {
+		return 0
+	}
+	return aph.Total / uint64(len(aph.Phases))
+}
+
+// PercentileTime returns the p'th percentile (0 < p <= 100) of the phase times,
+// using the nearest-rank method.
+func (aph *PhaseSet) PercentileTime(p float64) uint64 {
+	l := len(aph.Phases)
+	if l == 0 {
+		return 0
+	}
+	scratch := make([]PhaseTime, 0, l)
+	scratch = append(scratch, aph.Phases...)
+	sort.Slice(scratch, func(i, j int) bool {
+		return scratch[i] < scratch[j]
+	})
+	return uint64(percentile(scratch, p))
+}
+
+// percentile returns the p'th percentile (0 < p <= 100) of sorted, which must not be empty,
+// using the nearest-rank method.
+func percentile(sorted []PhaseTime, p float64) PhaseTime {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// A stringIndex assigns consecutive numbers to strings.  It is safe for concurrent use.
+type stringIndex struct {
+	mu sync.Mutex
+	m  map[string]int32
+	i  []string
+}
+
+func (x *stringIndex) Index(s string) int32 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	i, ok := x.m[s]
+	if !ok {
+		i = int32(len(x.i))
+		x.m[s] = i
+		x.i = append(x.i, s)
+	}
+	return i
+}
+
+func (x *stringIndex) String(i int32) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.i[i]
+}
+
+func (x *stringIndex) NextIndex() int32 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return int32(len(x.i))
+}
+
+// Strings returns a copy of the strings, indexed by number.
+func (x *stringIndex) Strings() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]string(nil), x.i...)
+}
+
+func newStringIndex() *stringIndex {
+	return &stringIndex{m: make(map[string]int32)}
+}
+
+// internedStrings is shared by all Parsers, which may run concurrently.
+var (
+	internMu        sync.Mutex
+	internedStrings = make(map[string]string)
+)
+
+func intern(s string) string {
+	internMu.Lock()
+	defer internMu.Unlock()
+	if r, ok := internedStrings[s]; ok {
+		return r
+	}
+	internedStrings[s] = s
+	return s
+}
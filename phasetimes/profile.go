@@ -0,0 +1,101 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// BinOptions say which compilations of a configuration are binned, and how.
+type BinOptions struct {
+	Bins          int      // number of bins, at most one per compilation; zero for no bins, just Samples
+	Stat          Stat     // normalizes each bin's phase times
+	Mode          BinMode  // how compilations are assigned to the Bins bins
+	Edges         []uint64 // if not nil, bin by total time at these edges instead of Bins and Mode; see BinByEdges
+	SortBy        string   // if not empty, sort compilations into bins by this phase's time; only with BinCount
+	RequirePhases int      // compilations with fewer nonzero phases than this are left out
+	MinTotal      uint64   // compilations with a smaller total are left out
+}
+
+// A Profile is the binned phase times of one configuration.
+type Profile struct {
+	Config     string
+	Phases     []string    // phase names, indexed by phase number
+	Samples    []*PhaseSet // the compilations binned, sorted as for Samples
+	Incomplete int         // compilations left out by BinOptions.RequirePhases
+	Small      int         // compilations left out by BinOptions.MinTotal
+	Bins       []*PhaseSet // nil for bins with no compilations
+	Ranges     [][2]int    // Ranges[i] holds the [start, end) indices in Samples of the compilations in Bins[i]
+	Ratios     [][]float64 // Ratios[i][j] is phase j's time in Bins[i] over its Norm, NaN if Norm is zero
+	Totals     []uint64    // each phase's total time over Samples
+}
+
+// Binned returns the profile of config, binned according to opts.
+func (r *Result) Binned(config string, opts BinOptions) (*Profile, error) {
+	if _, ok := r.configs[config]; !ok {
+		return nil, fmt.Errorf("no configuration %s", config)
+	}
+	phases := r.Phases()
+	sortBy := -1
+	if opts.SortBy != "" {
+		for i, p := range phases {
+			if p == opts.SortBy {
+				sortBy = i
+			}
+		}
+		if sortBy < 0 {
+			return nil, fmt.Errorf("no phase %s, phases are %s", opts.SortBy, strings.Join(phases, ", "))
+		}
+		if opts.Mode != BinCount || opts.Edges != nil {
+			return nil, fmt.Errorf("compilations sorted by %s time cannot be binned by total time", opts.SortBy)
+		}
+	}
+
+	p := &Profile{Config: config, Phases: phases, Totals: make([]uint64, len(phases))}
+	p.Samples, p.Incomplete = r.Samples(config, opts.RequirePhases, sortBy)
+	if opts.MinTotal > 0 {
+		kept := p.Samples[:0]
+		for _, sample := range p.Samples {
+			if sample.Total >= opts.MinTotal {
+				kept = append(kept, sample)
+			}
+		}
+		p.Small = len(p.Samples) - len(kept)
+		p.Samples = kept
+	}
+	for _, sample := range p.Samples {
+		for i, t := range sample.Phases {
+			p.Totals[i] += uint64(t)
+		}
+	}
+
+	switch {
+	case opts.Edges != nil:
+		p.Bins, p.Ranges = r.BinByEdges(p.Samples, opts.Edges, opts.Stat)
+	case opts.Bins > 0:
+		bins := opts.Bins
+		if bins > len(p.Samples) {
+			bins = len(p.Samples)
+		}
+		p.Bins, p.Ranges = r.BinByTotal(p.Samples, bins, opts.Stat, opts.Mode)
+	}
+	p.Ratios = make([][]float64, len(p.Bins))
+	for i, b := range p.Bins {
+		if b == nil {
+			continue
+		}
+		p.Ratios[i] = make([]float64, len(phases))
+		for j := range p.Ratios[i] {
+			if b.Norm == 0 {
+				p.Ratios[i][j] = math.NaN()
+				continue
+			}
+			p.Ratios[i][j] = float64(b.phase(j)) / float64(b.Norm)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// A sampler chooses the compilations of one configuration kept for Options.Sample.
+// Each compilation's priority is a hash of its key and Options.Seed, and those with the
+// Sample smallest priorities are kept.  Wherever the compilations fall in the log, that is
+// a uniform random sample of them, chosen in one pass in bounded memory, like a reservoir.
+// Because a compilation's priority never changes, one that was passed over or evicted is
+// passed over again, not half-recorded, when more of its phase times appear.
+type sampler struct {
+	kept []sampled // a heap, largest priority first
+}
+
+type sampled struct {
+	priority uint64
+	c        Compilation
+}
+
+func (s *sampler) Len() int           { return len(s.kept) }
+func (s *sampler) Less(i, j int) bool { return s.kept[i].priority > s.kept[j].priority }
+func (s *sampler) Swap(i, j int)      { s.kept[i], s.kept[j] = s.kept[j], s.kept[i] }
+func (s *sampler) Push(x interface{}) { s.kept = append(s.kept, x.(sampled)) }
+func (s *sampler) Pop() interface{} {
+	x := s.kept[len(s.kept)-1]
+	s.kept = s.kept[:len(s.kept)-1]
+	return x
+}
+
+// admit reports whether c, a compilation not already kept, is to be kept among the n
+// sampled, and if so whether that evicts another, which is returned.
+func (s *sampler) admit(c Compilation, seed uint64, n int) (keep bool, evict Compilation, evicted bool) {
+	x := sampled{priority: samplePriority(c, seed), c: c}
+	if len(s.kept) < n {
+		heap.Push(s, x)
+		return true, Compilation{}, false
+	}
+	if x.priority >= s.kept[0].priority {
+		return false, Compilation{}, false
+	}
+	evict = s.kept[0].c
+	s.kept[0] = x
+	heap.Fix(s, 0)
+	return true, evict, true
+}
+
+// samplePriority returns c's pseudo-random priority for a sampler.
+func samplePriority(c Compilation, seed uint64) uint64 {
+	h := fnv.New64a()
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], seed)
+	h.Write(b[:])
+	for _, s := range []string{c.Pkg, c.Path, c.Func} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	// FNV's bits are poorly mixed for similar keys; finish as splitmix64 does.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// savedResult is the gob form of a Result.  Phase times are indexed by position in Phases,
+// which is in the order the phases were first seen, so that the order survives a reload.
+type savedResult struct {
+	Phases  []string
+	Configs map[string][]savedCompilation
+}
+
+type savedCompilation struct {
+	Compilation Compilation
+	Times       []uint64
+	Zeros       []int // phases recorded with a zero time; see Options.IncludeZero
+}
+
+// Save writes the compilations and phase times accumulated so far to w, to be read back
+// by Parser.Load.
+func (r *Result) Save(w io.Writer) error {
+	s := savedResult{Phases: r.Phases(), Configs: make(map[string][]savedCompilation)}
+	for cfg, m := range r.configs {
+		cs := make([]savedCompilation, 0, len(m))
+		for c, ps := range m {
+			sc := savedCompilation{Compilation: c, Times: make([]uint64, len(ps.Phases))}
+			for i, t := range ps.Phases {
+				sc.Times[i] = uint64(t)
+				if ps.zero(i) {
+					sc.Zeros = append(sc.Zeros, i)
+				}
+			}
+			cs = append(cs, sc)
+		}
+		// Sort for reproducible files.
+		sort.Slice(cs, func(i, j int) bool { return cs[i].Compilation.less(cs[j].Compilation) })
+		s.Configs[cfg] = cs
+	}
+	return gob.NewEncoder(w).Encode(&s)
+}
+
+// Load reads compilations and phase times written by Result.Save from r, and adds them to
+// those accumulated by p as if they had been parsed from a log, with p's Dup and IncludeZero.
+// The phases are renumbered to match p's; p's other Options are not applied again.
+func (p *Parser) Load(r io.Reader) error {
+	var s savedResult
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("could not read saved state: %w", err)
+	}
+	phases := make([]int32, len(s.Phases))
+	for i, name := range s.Phases {
+		phases[i] = p.r.phaseIndex.Index(intern(name))
+	}
+	for cfg, cs := range s.Configs {
+		cfg = intern(cfg)
+		compilations, ok := p.r.configs[cfg]
+		if !ok {
+			compilations = make(map[Compilation]*PhaseSet)
+			p.r.configs[cfg] = compilations
+		}
+		for _, sc := range cs {
+			if len(sc.Times) > len(phases) {
+				return fmt.Errorf("bad saved state: %s has %d phase times, but there are only %d phases", sc.Compilation.Func, len(sc.Times), len(phases))
+			}
+			c := Compilation{Pkg: intern(sc.Compilation.Pkg), Path: intern(sc.Compilation.Path), Func: intern(sc.Compilation.Func)}
+			ps := compilations[c]
+			if ps == nil {
+				ps = p.r.newPhaseSet()
+				ps.Compilation = c
+				compilations[c] = ps
+			}
+			for i, t := range sc.Times {
+				if t != 0 {
+					ps.setTime(phases[i], t, p.Dup, p.IncludeZero)
+				}
+			}
+			for _, i := range sc.Zeros {
+				if i < len(phases) {
+					ps.setTime(phases[i], 0, p.Dup, true)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,725 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// A Unit is the unit in which the CSV output gives times.
+type Unit int
+
+const (
+	UnitNS Unit = iota // nanoseconds
+	UnitUS             // microseconds
+	UnitMS             // milliseconds
+	UnitS              // seconds
+)
+
+var unitNames = []string{"ns", "us", "ms", "s"}
+
+func (u Unit) String() string {
+	return unitNames[u]
+}
+
+// ParseUnit returns the Unit named s.
+func ParseUnit(s string) (Unit, error) {
+	for i, n := range unitNames {
+		if s == n {
+			return Unit(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown time unit %q, expected one of %v", s, unitNames)
+}
+
+// format returns t, in nanoseconds, converted to unit u, to microsecond precision.
+func (u Unit) format(t uint64) string {
+	switch u {
+	case UnitUS:
+		return fmt.Sprintf("%.3f", float64(t)/1e3)
+	case UnitMS:
+		return fmt.Sprintf("%.3f", float64(t)/1e6)
+	case UnitS:
+		return fmt.Sprintf("%.6f", float64(t)/1e9)
+	}
+	return fmt.Sprintf("%d", t)
+}
+
+// CSVOptions control optional parts of the CSV output.
+type CSVOptions struct {
+	ShareDrift bool     // add per-phase share-of-bin-total columns and a drift footer
+	Stat       Stat     // the statistic used to bin, for the title
+	Columns    []int    // if not nil, the phase numbers to write, in order; otherwise all phases
+	SortBy     string   // if not empty, the phase that compilations were sorted by, for the title
+	Absolute   bool     // write the bin total of each phase's times instead of its ratio to Norm
+	Unit       Unit     // the unit of the times written; only UnitNS is meaningful for a Metric other than time
+	Metric     Metric   // the measurement written, for the column headings
+	Stats      bool     // add per-phase coefficient-of-variation, minimum, and maximum columns
+	Edges      []uint64 // if not nil, the edges passed to Result.BinByEdges, for the bin labels
+	Cumulative bool     // add columns for the running total of the bin totals, and its share of the grand total
+	Comma      rune     // if not zero, the field delimiter instead of a comma
+}
+
+// newWriter returns a csv.Writer writing to w with opts.Comma.
+func (opts *CSVOptions) newWriter(w io.Writer) *csv.Writer {
+	csvw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		csvw.Comma = opts.Comma
+	}
+	return csvw
+}
+
+// unitLabel returns the unit of the values written, for column headings: the time unit, or
+// for a count, the Metric counted.
+func (opts *CSVOptions) unitLabel() string {
+	if opts.Metric != MetricTime {
+		return opts.Metric.String()
+	}
+	return opts.Unit.String()
+}
+
+// columns returns the phase numbers to write, out of n phases.
+func (opts *CSVOptions) columns(n int) []int {
+	if opts.Columns != nil {
+		return opts.Columns
+	}
+	cols := make([]int, n)
+	for i := range cols {
+		cols[i] = i
+	}
+	return cols
+}
+
+// binLabel returns the label for bin number binI, which holds the compilations in rng:
+// the range of compilation indices, or the range of total times if opts.Edges is set.
+func (opts *CSVOptions) binLabel(binI int, rng [2]int) string {
+	if opts.Edges == nil {
+		return fmt.Sprintf("[%d,%d)", rng[0], rng[1])
+	}
+	lo, hi := "0", "inf"
+	if binI > 0 {
+		lo = opts.Unit.format(opts.Edges[binI-1])
+	}
+	if binI < len(opts.Edges) {
+		hi = opts.Unit.format(opts.Edges[binI])
+	}
+	return fmt.Sprintf("[%s,%s) %s", lo, hi, opts.unitLabel())
+}
+
+// WriteCSV writes the binned profile for configuration cfg, as computed by Result.Bin, to w.
+// Each row is a bin, giving the number of compilations in the bin and the range of their
+// total times, then for each phase the bin total of that phase's times divided by the bin's
+// Norm (or, with opts.Absolute, the undivided bin total), followed by the bin total;
+// a final row gives the phase totals.
+func WriteCSV(w io.Writer, cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, opts CSVOptions) error {
+	csvw := opts.newWriter(w)
+	title, rows := csvTable(cfg, phases, bins, ranges, opts)
+	csvw.Write(title)
+	csvw.WriteAll(rows)
+	return csvw.Error()
+}
+
+// csvTable returns the title row and the remaining rows of the CSV for configuration cfg.
+func csvTable(cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, opts CSVOptions) (title []string, rows [][]string) {
+	cols := opts.columns(len(phases))
+
+	desc := fmt.Sprintf("%s:Binned compilation phase timing profiles, bin total of phase times / %s; empty where that is zero", cfg, opts.Stat.describe())
+	if opts.Absolute {
+		desc = fmt.Sprintf("%s:Binned compilation phase timing profiles, bin total of phase times (%s)", cfg, opts.unitLabel())
+	}
+	if opts.SortBy != "" {
+		desc += fmt.Sprintf(", compilations binned by %s time", opts.SortBy)
+	}
+	title = []string{desc, "count", "min total (" + opts.unitLabel() + ")", "max total (" + opts.unitLabel() + ")"}
+	for _, i := range cols {
+		title = append(title, phases[i])
+	}
+	title = append(title, "TOTAL ("+opts.unitLabel()+")")
+	if opts.ShareDrift {
+		for _, i := range cols {
+			title = append(title, phases[i]+" share")
+		}
+	}
+	if opts.Stats {
+		for _, i := range cols {
+			title = append(title, phases[i]+" cv")
+		}
+		for _, i := range cols {
+			title = append(title, phases[i]+" min ("+opts.unitLabel()+")", phases[i]+" max ("+opts.unitLabel()+")")
+		}
+	}
+	if opts.Cumulative {
+		title = append(title, "CUMULATIVE TOTAL ("+opts.unitLabel()+")", "CUMULATIVE SHARE")
+	}
+
+	phaseTotals := make([]PhaseTime, len(phases)+1)
+	count := 0
+	var grandTotal, cumulative uint64
+	for _, b := range bins {
+		if b != nil {
+			grandTotal += b.Total
+		}
+	}
+
+	for binI, b := range bins {
+		if b == nil {
+			continue
+		}
+		row := []string{}
+		row = append(row, opts.binLabel(binI, ranges[binI]))
+		row = append(row, fmt.Sprintf("%d", ranges[binI][1]-ranges[binI][0]))
+		row = append(row, opts.Unit.format(b.MinTotal), opts.Unit.format(b.MaxTotal))
+		count += ranges[binI][1] - ranges[binI][0]
+		for i := range phases {
+			phaseTotals[i] += b.Phases[i]
+		}
+		for _, i := range cols {
+			if opts.Absolute {
+				row = append(row, opts.Unit.format(uint64(b.Phases[i])))
+			} else if b.Norm == 0 {
+				row = append(row, "")
+			} else {
+				row = append(row, fmt.Sprintf("%5.2f", float64(b.Phases[i])/float64(b.Norm)))
+			}
+		}
+		row = append(row, opts.Unit.format(b.Total))
+		if opts.ShareDrift {
+			for _, i := range cols {
+				row = append(row, fmt.Sprintf("%5.3f", b.Share(i)))
+			}
+		}
+		if opts.Stats {
+			n := float64(ranges[binI][1] - ranges[binI][0])
+			for _, i := range cols {
+				if b.Phases[i] == 0 {
+					row = append(row, "")
+					continue
+				}
+				// The coefficient of variation is the standard deviation over the mean.
+				row = append(row, fmt.Sprintf("%5.3f", b.StdDev[i]/(float64(b.Phases[i])/n)))
+			}
+			for _, i := range cols {
+				row = append(row, opts.Unit.format(uint64(b.Min[i])), opts.Unit.format(uint64(b.Max[i])))
+			}
+		}
+		if opts.Cumulative {
+			cumulative += b.Total
+			row = append(row, opts.Unit.format(cumulative), fmt.Sprintf("%5.3f", float64(cumulative)/float64(grandTotal)))
+		}
+		rows = append(rows, row)
+	}
+
+	row := []string{}
+	row = append(row, "PHASE TOTALS ("+opts.unitLabel()+")")
+	row = append(row, fmt.Sprintf("%d", count), "", "")
+	total := PhaseTime(0)
+	for i := range phases {
+		total += phaseTotals[i]
+	}
+	for _, i := range cols {
+		row = append(row, opts.Unit.format(uint64(phaseTotals[i])))
+	}
+	row = append(row, opts.Unit.format(uint64(total)))
+	rows = append(rows, row)
+
+	if opts.ShareDrift {
+		// Compare the share of the largest compilations to that of the smallest;
+		// a phase whose share grows is scaling worse than the others.
+		var first, last *PhaseSet
+		for _, b := range bins {
+			if b == nil || b.Total == 0 {
+				continue
+			}
+			if first == nil {
+				first = b
+			}
+			last = b
+		}
+		row := []string{"SHARE DRIFT (last bin - first bin)"}
+		for i := 0; i <= len(cols)+3; i++ {
+			row = append(row, "")
+		}
+		for _, i := range cols {
+			if first == nil {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, fmt.Sprintf("%5.3f", last.Share(i)-first.Share(i)))
+		}
+		rows = append(rows, row)
+	}
+
+	return title, rows
+}
+
+// A CombinedCSVWriter writes the binned profiles of several configurations into a single CSV,
+// with the configuration name in the first column.
+type CombinedCSVWriter struct {
+	csvw        *csv.Writer
+	wroteHeader bool
+}
+
+// NewCombinedCSVWriter returns a CombinedCSVWriter writing to w.
+func NewCombinedCSVWriter(w io.Writer) *CombinedCSVWriter {
+	return &CombinedCSVWriter{csvw: csv.NewWriter(w)}
+}
+
+// Write adds the binned profile for configuration cfg, in the same form as WriteCSV.
+// The column headings are written before the first configuration.
+func (c *CombinedCSVWriter) Write(cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, opts CSVOptions) error {
+	title, rows := csvTable(cfg, phases, bins, ranges, opts)
+	if !c.wroteHeader {
+		if opts.Comma != 0 {
+			c.csvw.Comma = opts.Comma
+		}
+		c.csvw.Write(append([]string{"config", "bin"}, title[1:]...))
+		c.wroteHeader = true
+	}
+	for _, row := range rows {
+		c.csvw.Write(append([]string{cfg}, row...))
+	}
+	return c.csvw.Error()
+}
+
+// Flush writes any buffered rows to the underlying io.Writer.
+func (c *CombinedCSVWriter) Flush() error {
+	c.csvw.Flush()
+	return c.csvw.Error()
+}
+
+// A RawCSVWriter writes unbinned phase times, one row per compilation, for one or more
+// configurations, with the configuration name in the first column.
+type RawCSVWriter struct {
+	csvw        *csv.Writer
+	wroteHeader bool
+}
+
+// NewRawCSVWriter returns a RawCSVWriter writing to w.
+func NewRawCSVWriter(w io.Writer) *RawCSVWriter {
+	return &RawCSVWriter{csvw: csv.NewWriter(w)}
+}
+
+// Write adds a row for each of the compilations in samples, from configuration cfg, giving the
+// compilation's package, path, and function, its time in each phase, its total, and its median.
+// Rows are written in order of decreasing total time.  Only opts.Columns and opts.Unit are used.
+func (c *RawCSVWriter) Write(cfg string, phases []string, samples []*PhaseSet, opts CSVOptions) error {
+	cols := opts.columns(len(phases))
+	if !c.wroteHeader {
+		if opts.Comma != 0 {
+			c.csvw.Comma = opts.Comma
+		}
+		title := []string{"config", "package", "path", "func"}
+		for _, i := range cols {
+			title = append(title, phases[i]+" ("+opts.unitLabel()+")")
+		}
+		title = append(title, "TOTAL ("+opts.unitLabel()+")", "MEDIAN ("+opts.unitLabel()+")")
+		c.csvw.Write(title)
+		c.wroteHeader = true
+	}
+
+	sorted := append([]*PhaseSet(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Total > sorted[j].Total
+	})
+	for _, s := range sorted {
+		row := []string{cfg, s.Compilation.Pkg, s.Compilation.Path, s.Compilation.Func}
+		for _, i := range cols {
+			row = append(row, opts.Unit.format(uint64(s.phase(i))))
+		}
+		row = append(row, opts.Unit.format(s.Total), opts.Unit.format(s.MedianTime()))
+		c.csvw.Write(row)
+	}
+	return c.csvw.Error()
+}
+
+// Flush writes any buffered rows to the underlying io.Writer.
+func (c *RawCSVWriter) Flush() error {
+	c.csvw.Flush()
+	return c.csvw.Error()
+}
+
+// WriteBenchstat writes the phase times of the compilations in samples, from configuration cfg,
+// to w as Go benchmark results that golang.org/x/perf/cmd/benchstat can read, one line per
+// compilation and phase, named (with spaces in names replaced by underscores)
+//
+//	BenchmarkPhase/config=<cfg>/phase=<phase> 1 <time> ns/op
+//
+// (with allocs/op or B/op instead for opts.Metric allocs or bytes)
+// followed by a line for the compilation's total, as phase TOTAL, so that
+// "benchstat -col /config" compares configurations phase by phase.  Phases with no recorded
+// time in a compilation are left out for it.  Only opts.Columns and opts.Metric are used.
+func WriteBenchstat(w io.Writer, cfg string, phases []string, samples []*PhaseSet, opts CSVOptions) error {
+	cols := opts.columns(len(phases))
+	unit := benchUnits[opts.Metric]
+	names := make([]string, len(cols))
+	for k, i := range cols {
+		names[k] = benchName(cfg, phases[i])
+	}
+	total := benchName(cfg, "TOTAL")
+	bw := bufio.NewWriter(w)
+	for _, s := range samples {
+		for k, i := range cols {
+			if t := s.phase(i); t != 0 || s.zero(i) {
+				fmt.Fprintf(bw, "%s 1 %d %s\n", names[k], t, unit)
+			}
+		}
+		fmt.Fprintf(bw, "%s 1 %d %s\n", total, s.Total, unit)
+	}
+	return bw.Flush()
+}
+
+// benchUnits are the benchmark units of the Metrics, as the testing package names them.
+var benchUnits = []string{"ns/op", "allocs/op", "B/op"}
+
+// benchNameReplacer removes the characters that benchstat would take as ending a name or part.
+var benchNameReplacer = strings.NewReplacer(" ", "_", "\t", "_", "/", "_")
+
+// benchName returns the benchmark name for phase of configuration cfg.
+func benchName(cfg, phase string) string {
+	return "BenchmarkPhase/config=" + benchNameReplacer.Replace(cfg) + "/phase=" + benchNameReplacer.Replace(phase)
+}
+
+// WriteFolded writes the phase times of the compilations in samples, from configuration cfg,
+// to w in the "folded stacks" form read by flamegraph.pl, one line per function and phase,
+//
+//	<cfg>;<package>;<func>;<phase> <time>
+//
+// with the times of compilations that share a line (such as one function's at different
+// positions) summed, and semicolons in names replaced by underscores.  Compilations are
+// written in the order of samples.  Only opts.Columns is used.
+func WriteFolded(w io.Writer, cfg string, phases []string, samples []*PhaseSet, opts CSVOptions) error {
+	cols := opts.columns(len(phases))
+	var stacks []string
+	weights := make(map[string]uint64)
+	for _, s := range samples {
+		prefix := foldedNameReplacer.Replace(cfg) + ";" + foldedNameReplacer.Replace(s.Compilation.Pkg) + ";" + foldedNameReplacer.Replace(s.Compilation.Func) + ";"
+		for _, i := range cols {
+			t := s.phase(i)
+			if t == 0 {
+				continue
+			}
+			stack := prefix + foldedNameReplacer.Replace(phases[i])
+			if _, ok := weights[stack]; !ok {
+				stacks = append(stacks, stack)
+			}
+			weights[stack] += uint64(t)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	for _, stack := range stacks {
+		fmt.Fprintf(bw, "%s %d\n", stack, weights[stack])
+	}
+	return bw.Flush()
+}
+
+// foldedNameReplacer removes the stack frame separator from names.
+var foldedNameReplacer = strings.NewReplacer(";", "_", "\n", "_")
+
+// WritePackageCSV writes the per-package phase times for configuration cfg, as computed by
+// Result.ByPackage, to w.  Each row is a package, giving the total time of each phase and
+// the package total.  Only opts.Columns and opts.Unit are used.
+func WritePackageCSV(w io.Writer, cfg string, phases []string, pkgs []*PhaseSet, opts CSVOptions) error {
+	csvw := opts.newWriter(w)
+	cols := opts.columns(len(phases))
+	title := []string{fmt.Sprintf("%s:Compilation phase times summed by package (%s)", cfg, opts.unitLabel())}
+	for _, i := range cols {
+		title = append(title, phases[i])
+	}
+	title = append(title, "TOTAL ("+opts.unitLabel()+")")
+	csvw.Write(title)
+	for _, p := range pkgs {
+		row := []string{p.Compilation.Pkg}
+		for _, i := range cols {
+			row = append(row, opts.Unit.format(uint64(p.phase(i))))
+		}
+		row = append(row, opts.Unit.format(p.Total))
+		csvw.Write(row)
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
+
+// WriteCulpritsCSV writes, for configuration cfg, a row for each bin and phase naming the
+// compilation with the largest time in that phase among the bin's compilations, with that time.
+// opts.Columns, opts.Unit, and opts.Edges are used.
+func WriteCulpritsCSV(w io.Writer, cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, opts CSVOptions) error {
+	csvw := opts.newWriter(w)
+	cols := opts.columns(len(phases))
+	csvw.Write([]string{cfg + ":bin", "phase", "package", "path", "func", opts.Metric.heading() + " (" + opts.unitLabel() + ")"})
+	for binI, b := range bins {
+		if b == nil {
+			continue
+		}
+		label := opts.binLabel(binI, ranges[binI])
+		for _, i := range cols {
+			c := b.Culprits[i]
+			if c == nil {
+				continue
+			}
+			csvw.Write([]string{label, phases[i], c.Compilation.Pkg, c.Compilation.Path, c.Compilation.Func, opts.Unit.format(uint64(c.Phases[i]))})
+		}
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
+
+// WriteAlignedCSV writes the compilations matched across configs by Result.Align, one row
+// per compilation, giving each phase's time in each configuration side by side, then the
+// totals.  opts.Columns and opts.Unit are used.
+func WriteAlignedCSV(w io.Writer, configs, phases []string, aligned [][]*PhaseSet, opts CSVOptions) error {
+	csvw := opts.newWriter(w)
+	cols := opts.columns(len(phases))
+	u := " (" + opts.unitLabel() + ")"
+	title := []string{"package", "path", "func"}
+	for _, i := range cols {
+		for _, cfg := range configs {
+			title = append(title, phases[i]+" "+cfg+u)
+		}
+	}
+	for _, cfg := range configs {
+		title = append(title, "TOTAL "+cfg+u)
+	}
+	csvw.Write(title)
+	for _, row := range aligned {
+		c := row[0].Compilation
+		out := []string{c.Pkg, c.Path, c.Func}
+		for _, i := range cols {
+			for _, ps := range row {
+				out = append(out, opts.Unit.format(uint64(ps.phase(i))))
+			}
+		}
+		for _, ps := range row {
+			out = append(out, opts.Unit.format(ps.Total))
+		}
+		csvw.Write(out)
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
+
+// WriteSummaryCSV writes, for configuration cfg, each phase's total time over all the bins
+// and its percentage of the grand total, largest first.  opts.Columns and opts.Unit are used;
+// the percentages are always of the total over all phases.
+func WriteSummaryCSV(w io.Writer, cfg string, phases []string, bins []*PhaseSet, opts CSVOptions) error {
+	totals := make([]uint64, len(phases))
+	grand := uint64(0)
+	for _, b := range bins {
+		if b == nil {
+			continue
+		}
+		for i := range phases {
+			totals[i] += uint64(b.phase(i))
+			grand += uint64(b.phase(i))
+		}
+	}
+	cols := append([]int(nil), opts.columns(len(phases))...)
+	sort.SliceStable(cols, func(i, j int) bool {
+		return totals[cols[i]] > totals[cols[j]]
+	})
+
+	csvw := opts.newWriter(w)
+	csvw.Write([]string{cfg + ":phase", "total (" + opts.unitLabel() + ")", "percent"})
+	for _, i := range cols {
+		csvw.Write([]string{phases[i], opts.Unit.format(totals[i]), fmt.Sprintf("%.2f", 100*float64(totals[i])/float64(grand))})
+	}
+	csvw.Write([]string{"TOTAL", opts.Unit.format(grand), "100.00"})
+	csvw.Flush()
+	return csvw.Error()
+}
+
+// WritePercentilesCSV writes, for configuration cfg, a row for each phase giving the number of
+// the compilations in samples with a recorded time in that phase, and the 50th, 90th, and 99th
+// percentiles and the maximum of those times.  Only opts.Columns and opts.Unit are used.
+func WritePercentilesCSV(w io.Writer, cfg string, phases []string, samples []*PhaseSet, opts CSVOptions) error {
+	csvw := opts.newWriter(w)
+	u := " (" + opts.unitLabel() + ")"
+	csvw.Write([]string{cfg + ":phase", "count", "p50" + u, "p90" + u, "p99" + u, "max" + u})
+	times := make([]PhaseTime, 0, len(samples))
+	for _, i := range opts.columns(len(phases)) {
+		times = times[:0]
+		for _, s := range samples {
+			if t := s.phase(i); t != 0 || s.zero(i) {
+				times = append(times, t)
+			}
+		}
+		if len(times) == 0 {
+			csvw.Write([]string{phases[i], "0", "", "", "", ""})
+			continue
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		row := []string{phases[i], fmt.Sprintf("%d", len(times))}
+		for _, p := range []float64{50, 90, 99, 100} {
+			row = append(row, opts.Unit.format(uint64(percentile(times, p))))
+		}
+		csvw.Write(row)
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
+
+// WriteMarkdown writes the same table as WriteCSV, as a GitHub-flavored Markdown table
+// preceded by the CSV's description as a heading.  Columns are padded to line up, and a
+// | in a cell, as in a phase or function name, is escaped.
+func WriteMarkdown(w io.Writer, cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, opts CSVOptions) error {
+	title, rows := csvTable(cfg, phases, bins, ranges, opts)
+	table := append([][]string{append([]string{"bin"}, title[1:]...)}, rows...)
+
+	var widths []int
+	for _, row := range table {
+		for i, cell := range row {
+			row[i] = strings.ReplaceAll(strings.TrimSpace(cell), "|", `\|`)
+			if i >= len(widths) {
+				widths = append(widths, 3) // at least as wide as the --- separator
+			}
+			if n := len(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "### %s\n\n", title[0])
+	writeRow := func(row []string) {
+		for i, width := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			if i == 0 {
+				fmt.Fprintf(bw, "| %-*s ", width, cell)
+			} else {
+				fmt.Fprintf(bw, "| %*s ", width, cell)
+			}
+		}
+		fmt.Fprintf(bw, "|\n")
+	}
+	writeRow(table[0])
+	for i, width := range widths {
+		if i == 0 {
+			fmt.Fprintf(bw, "|:%s", strings.Repeat("-", width+1))
+		} else {
+			fmt.Fprintf(bw, "|%s:", strings.Repeat("-", width+1))
+		}
+	}
+	fmt.Fprintf(bw, "|\n")
+	for _, row := range table[1:] {
+		writeRow(row)
+	}
+	return bw.Flush()
+}
+
+// WriteGnuplotData writes, for configuration cfg, one line per bin giving the bin number
+// and each phase's ratio, as in WriteCSV, in a form gnuplot can read.
+// Bins with no compilations or a zero Norm are left out.  opts.Columns is used.
+func WriteGnuplotData(w io.Writer, cfg string, phases []string, bins []*PhaseSet, opts CSVOptions) error {
+	cols := opts.columns(len(phases))
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s: bin", cfg)
+	for _, i := range cols {
+		fmt.Fprintf(bw, "\t%q", phases[i])
+	}
+	fmt.Fprintf(bw, "\n")
+	for binI, b := range bins {
+		if b == nil || b.Norm == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "%d", binI)
+		for _, i := range cols {
+			fmt.Fprintf(bw, "\t%g", float64(b.Phases[i])/float64(b.Norm))
+		}
+		fmt.Fprintf(bw, "\n")
+	}
+	return bw.Flush()
+}
+
+// WriteGnuplotScript writes a gnuplot script that plots one line per phase from the data
+// file named data, as written by WriteGnuplotData with the same phases and opts.  gnuplot
+// opens data relative to the directory it is run in, so for a data file written beside the
+// script, data should be its base name.
+func WriteGnuplotScript(w io.Writer, cfg, data string, phases []string, opts CSVOptions) error {
+	cols := opts.columns(len(phases))
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "set title %q\n", cfg+": phase time / "+opts.Stat.describe())
+	fmt.Fprintf(bw, "set xlabel \"bin (compilations sorted by total time)\"\n")
+	fmt.Fprintf(bw, "set ylabel \"ratio\"\n")
+	fmt.Fprintf(bw, "set key outside right\n")
+	fmt.Fprintf(bw, "plot")
+	for k, i := range cols {
+		sep := ","
+		if k == 0 {
+			sep = ""
+		}
+		fmt.Fprintf(bw, "%s \\\n\t%q using 1:%d with linespoints title %q", sep, data, k+2, phases[i])
+	}
+	fmt.Fprintf(bw, "\npause mouse close\n")
+	return bw.Flush()
+}
+
+// jsonProfile is the JSON form of one configuration's binned profile.
+type jsonProfile struct {
+	Config      string    `json:"config"`
+	Stat        string    `json:"stat"`
+	Phases      []string  `json:"phases"`
+	Bins        []jsonBin `json:"bins"`
+	PhaseTotals []uint64  `json:"phaseTotals"` // ns
+	Total       uint64    `json:"total"`       // ns
+}
+
+type jsonBin struct {
+	Start    int       `json:"start"`    // index of the first compilation in the bin
+	End      int       `json:"end"`      // index after the last compilation in the bin
+	Count    int       `json:"count"`    // number of compilations in the bin
+	MinTotal uint64    `json:"minTotal"` // ns, smallest compilation total in the bin
+	MaxTotal uint64    `json:"maxTotal"` // ns, largest compilation total in the bin
+	Ratios   []ratio   `json:"ratios"`
+	Phases   []uint64  `json:"phases"` // ns
+	Total    uint64    `json:"total"`  // ns
+	Median   uint64    `json:"median"` // ns
+	Norm     uint64    `json:"norm"`   // ns, the divisor of the ratios
+	StdDev   []float64 `json:"stddev"` // ns, per phase, over the compilations in the bin
+}
+
+// ratio is a bin ratio, which is undefined (null in JSON) when the bin's Norm is zero.
+type ratio float64
+
+func (r ratio) MarshalJSON() ([]byte, error) {
+	f := float64(r)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f)
+}
+
+// WriteJSON writes the binned profile for configuration cfg, as computed by Result.Bin, to w
+// as a JSON document.
+func WriteJSON(w io.Writer, cfg string, phases []string, bins []*PhaseSet, ranges [][2]int, stat Stat) error {
+	n := len(phases)
+	p := jsonProfile{Config: cfg, Stat: stat.String(), Phases: phases, PhaseTotals: make([]uint64, n)}
+	for k, b := range bins {
+		if b == nil {
+			continue
+		}
+		jb := jsonBin{Start: ranges[k][0], End: ranges[k][1], Count: ranges[k][1] - ranges[k][0],
+			MinTotal: b.MinTotal, MaxTotal: b.MaxTotal, Total: b.Total, Median: b.Median, Norm: b.Norm, StdDev: b.StdDev}
+		for i := 0; i < n; i++ {
+			jb.Ratios = append(jb.Ratios, ratio(float64(b.Phases[i])/float64(b.Norm)))
+			jb.Phases = append(jb.Phases, uint64(b.Phases[i]))
+			p.PhaseTotals[i] += uint64(b.Phases[i])
+			p.Total += uint64(b.Phases[i])
+		}
+		p.Bins = append(p.Bins, jb)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(&p)
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package phasetimes
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestMetricHeadings(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt	TIME(ns):ALLOCS:BYTES	500	7	4096	F
+`
+	r := parseLog(t, Options{Metric: MetricAllocs}, log)
+	samples, _ := r.Samples("Base", 0, -1)
+	var b bytes.Buffer
+	raw := NewRawCSVWriter(&b)
+	if err := raw.Write("Base", r.Phases(), samples, CSVOptions{Metric: MetricAllocs}); err != nil {
+		t.Fatal(err)
+	}
+	raw.Flush()
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(rows[0], ","), "config,package,path,func,opt (allocs),TOTAL (allocs),MEDIAN (allocs)"; got != want {
+		t.Errorf("headings are %s, want %s", got, want)
+	}
+	if got := rows[1][4]; got != "7" {
+		t.Errorf("opt is %s, want the 7 allocations", got)
+	}
+}
+
+func TestDelimiterRoundTrip(t *testing.T) {
+	cfg := `a,b "c"` + "\td"
+	r := newResult()
+	r.phaseIndex.Index("early, \"quoted\"\tphase")
+	ps := r.newPhaseSet()
+	ps.Compilation = Compilation{Pkg: "example.com/a,b", Path: `GOPATH/a "b".go:3:6:`, Func: "(*T[go.shape.int,go.shape.string]).M\t\"x\""}
+	ps.setTime(0, 100, DupFirst, false)
+	for _, comma := range []rune{0, '\t', ';'} {
+		var b bytes.Buffer
+		raw := NewRawCSVWriter(&b)
+		if err := raw.Write(cfg, r.Phases(), []*PhaseSet{ps}, CSVOptions{Comma: comma}); err != nil {
+			t.Fatal(err)
+		}
+		if err := raw.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		rd := csv.NewReader(&b)
+		if comma != 0 {
+			rd.Comma = comma
+		}
+		rows, err := rd.ReadAll()
+		if err != nil {
+			t.Fatalf("delimiter %q: %v", comma, err)
+		}
+		if got, want := rows[0][4], r.Phases()[0]+" (ns)"; got != want {
+			t.Errorf("delimiter %q: phase heading is %q, want %q", comma, got, want)
+		}
+		c := ps.Compilation
+		want := []string{cfg, c.Pkg, c.Path, c.Func, "100"}
+		if got := rows[1][:5]; strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("delimiter %q: row is %q, want %q", comma, got, want)
+		}
+	}
+}
+
+func TestMarkdownEscapesPipes(t *testing.T) {
+	log := compileLine("Base") + `# example.com/a
+../../a/a.go:3:6:	opt|early	TIME(ns)	100	F
+../../a/a.go:3:6:	regalloc	TIME(ns)	200	F
+`
+	r := parseLog(t, Options{}, log)
+	prof, err := r.Binned("Base", BinOptions{Bins: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteMarkdown(&b, "Base", prof.Phases, prof.Bins, prof.Ranges, CSVOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `opt\|early`) {
+		t.Errorf("phase name opt|early is not escaped:\n%s", b.String())
+	}
+	cells := -1
+	for _, line := range strings.Split(b.String(), "\n") {
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		n := strings.Count(line, "|") - strings.Count(line, `\|`)
+		if cells < 0 {
+			cells = n
+		} else if n != cells {
+			t.Errorf("row has %d cell delimiters, want %d like the header: %s", n, cells, line)
+		}
+	}
+}